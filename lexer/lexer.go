@@ -15,6 +15,8 @@ const (
 	TokenString     TokenType = "STRING"
 	TokenWhitespace TokenType = "WHITESPACE"
 	TokenSeparator  TokenType = "SEPARATOR"
+	TokenParam      TokenType = "PARAM"
+	TokenComment    TokenType = "COMMENT"
 	TokenUnknown    TokenType = "UNKNOWN"
 )
 
@@ -37,10 +39,68 @@ var keywords = map[string]bool{
 	"and":    true,
 	"or":     true,
 	"null":   true,
+	"not":    true,
+	"in":     true,
+	"exists": true,
+	"as":     true,
+
+	"between": true,
+	"like":    true,
+	"ilike":   true,
+	"escape":  true,
+
+	"case": true,
+	"when": true,
+	"then": true,
+	"else": true,
+	"end":  true,
+	"cast": true,
+
+	"union":     true,
+	"all":       true,
+	"intersect": true,
+	"except":    true,
+	"order":     true,
+	"by":        true,
+	"asc":       true,
+	"desc":      true,
+	"with":      true,
+	"recursive": true,
+	"over":      true,
+	"partition": true,
+	"window":    true,
+
+	"primary":    true,
+	"unique":     true,
+	"default":    true,
+	"check":      true,
+	"references": true,
+	"constraint": true,
+	"foreign":    true,
+	"on":         true,
+	"if":         true,
 
 	"update": true,
 	"delete": true,
 	"drop":   true,
+	"alter":  true,
+	"index":  true,
+
+	"view":         true,
+	"materialized": true,
+	"refresh":      true,
+
+	"begin":       true,
+	"commit":      true,
+	"rollback":    true,
+	"savepoint":   true,
+	"transaction": true,
+
+	"prepare":    true,
+	"execute":    true,
+	"deallocate": true,
+
+	"explain": true,
 }
 
 var operators = map[string]bool{
@@ -50,6 +110,7 @@ var operators = map[string]bool{
 	">":  true,
 	"<=": true,
 	">=": true,
+	"::": true,
 }
 
 var separators = map[rune]bool{
@@ -58,86 +119,149 @@ var separators = map[rune]bool{
 	'(': true,
 	')': true,
 	'*': true,
+	'[': true,
+	']': true,
+}
+
+// Span is the byte range [Start, End) a token occupies in the input.
+// For strings it includes the quotes.
+type Span struct {
+	Start int
+	End   int
 }
 
 // Tokenize splits a string into a slice of tokens
 func Tokenize(input string) []Token {
+	tokens, _ := TokenizeSpans(input)
+	return tokens
+}
+
+// TokenizeSpans splits a string into tokens like Tokenize and also returns
+// the span of every token, so callers can map tokens back to the input
+func TokenizeSpans(input string) ([]Token, []Span) {
+	return scan(input, false)
+}
+
+// TokenizeAll is like TokenizeSpans but also returns the whitespace and
+// comments between tokens, so the spans cover the whole input.
+// Comment values include their -- or /* */ markers.
+func TokenizeAll(input string) ([]Token, []Span) {
+	return scan(input, true)
+}
+
+// scan tokenizes input, keeping whitespace and comment tokens if trivia is set
+func scan(input string, trivia bool) ([]Token, []Span) {
 	var tokens []Token
+	var spans []Span
 	var current strings.Builder
+	start := 0
 	i := 0
 	inputLength := len(input)
 
+	emit := func(tok Token, from, to int) {
+		tokens = append(tokens, tok)
+		spans = append(spans, Span{Start: from, End: to})
+	}
+	flush := func() {
+		if current.Len() > 0 {
+			emit(createToken(current.String()), start, i)
+			current.Reset()
+		}
+	}
+
 	for i < inputLength {
 		ch := rune(input[i])
 
 		// Handle whitespace
 		if isWhitespace(ch) {
-			if current.Len() > 0 {
-				tokens = append(tokens, createToken(current.String()))
-				current.Reset()
+			flush()
+			from := i
+			for i < inputLength && isWhitespace(rune(input[i])) {
+				i++
+			}
+			if trivia {
+				emit(Token{Type: TokenWhitespace, Value: input[from:i]}, from, i)
 			}
-			i++
+			continue
+		}
+
+		// Handle comments: -- to the end of the line, or /* ... */
+		if n := commentLength(input[i:]); n > 0 {
+			flush()
+			if trivia {
+				emit(Token{Type: TokenComment, Value: input[i : i+n]}, i, i+n)
+			}
+			i += n
 			continue
 		}
 
 		// Handle separators
 		if isSeparator(ch) {
-			if current.Len() > 0 {
-				tokens = append(tokens, createToken(current.String()))
-				current.Reset()
-			}
-			tokens = append(tokens, Token{Type: TokenSeparator, Value: string(ch)})
+			flush()
+			emit(Token{Type: TokenSeparator, Value: string(ch)}, i, i+1)
 			i++
 			continue
 		}
 
 		// Handle operators
 		if isOperator(string(ch)) || (inputLength > i+1 && isOperator(input[i:i+2])) {
-			if current.Len() > 0 {
-				tokens = append(tokens, createToken(current.String()))
-				current.Reset()
-				i++
-			}
+			flush()
 			if i+1 < inputLength && isOperator(input[i:i+2]) {
-				tokens = append(tokens, Token{Type: TokenOperator, Value: input[i : i+2]})
+				emit(Token{Type: TokenOperator, Value: input[i : i+2]}, i, i+2)
 				i += 2
 			} else {
-				tokens = append(tokens, Token{Type: TokenOperator, Value: string(ch)})
+				emit(Token{Type: TokenOperator, Value: string(ch)}, i, i+1)
 				i++
 			}
 			continue
 		}
 
+		// Handle bind parameters: ?, $1, :name
+		if n := paramLength(input[i:]); n > 0 && (ch == '?' || current.Len() == 0) {
+			flush()
+			emit(Token{Type: TokenParam, Value: input[i : i+n]}, i, i+n)
+			i += n
+			continue
+		}
+
 		// Handle strings
 		if ch == '\'' || ch == '"' {
-			if current.Len() > 0 {
-				tokens = append(tokens, createToken(current.String()))
-				current.Reset()
-			}
+			flush()
+			from := i
 			quote := ch
 			i++
-			for i < len(input) && rune(input[i]) != quote {
+			for i < len(input) {
+				if rune(input[i]) == quote {
+					// a doubled quote stands for the quote character itself
+					if i+1 < len(input) && rune(input[i+1]) == quote {
+						current.WriteRune(quote)
+						i += 2
+						continue
+					}
+					break
+				}
 				current.WriteRune(rune(input[i]))
 				i++
 			}
-			tokens = append(tokens, Token{Type: TokenString, Value: current.String()})
-			current.Reset()
 			if i < len(input) {
 				i++ // skip closing quote
 			}
+			emit(Token{Type: TokenString, Value: current.String()}, from, i)
+			current.Reset()
 			continue
 		}
 
+		if current.Len() == 0 {
+			start = i
+		}
 		current.WriteRune(ch)
 		i++
 	}
 
 	// Add any remaining token
-	if current.Len() > 0 {
-		tokens = append(tokens, createToken(current.String()))
-	}
+	flush()
 
-	return tokens
+	return tokens, spans
 }
 
 // createToken determines the token type based on the value
@@ -155,6 +279,56 @@ func createToken(value string) Token {
 	return Token{Type: TokenIdentifier, Value: value}
 }
 
+// paramLength returns the length of the bind parameter at the start of s, or 0
+func paramLength(s string) int {
+	switch {
+	case s[0] == '?':
+		return 1
+	case s[0] == '$':
+		n := 1
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		if n == 1 {
+			return 0
+		}
+		return n
+	case s[0] == ':':
+		n := 1
+		for n < len(s) && (isLetter(rune(s[n])) || s[n] == '_' || (n > 1 && s[n] >= '0' && s[n] <= '9')) {
+			n++
+		}
+		if n == 1 {
+			return 0
+		}
+		return n
+	}
+	return 0
+}
+
+// commentLength returns the length of the comment at the start of s, or 0.
+// A line comment stops before the newline; an unterminated block comment
+// runs to the end of the input.
+func commentLength(s string) int {
+	switch {
+	case strings.HasPrefix(s, "--"):
+		if n := strings.IndexByte(s, '\n'); n >= 0 {
+			return len(strings.TrimSuffix(s[:n], "\r"))
+		}
+		return len(s)
+	case strings.HasPrefix(s, "/*"):
+		if n := strings.Index(s[2:], "*/"); n >= 0 {
+			return n + 4
+		}
+		return len(s)
+	}
+	return 0
+}
+
+func isLetter(ch rune) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
 func isWhitespace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
 }
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -237,6 +238,78 @@ func TestTokenizeTable(t *testing.T) {
 				{Type: TokenSeparator, Value: ";"},
 			},
 		},
+		{
+			name:  "operators without spaces",
+			input: "id=1 AND age>=18",
+			expected: []Token{
+				{Type: TokenIdentifier, Value: "id"},
+				{Type: TokenOperator, Value: "="},
+				{Type: TokenNumber, Value: "1"},
+				{Type: TokenKeyword, Value: "AND"},
+				{Type: TokenIdentifier, Value: "age"},
+				{Type: TokenOperator, Value: ">="},
+				{Type: TokenNumber, Value: "18"},
+			},
+		},
+		{
+			name:  "postgres style cast",
+			input: "SELECT price::INT FROM t",
+			expected: []Token{
+				{Type: TokenKeyword, Value: "SELECT"},
+				{Type: TokenIdentifier, Value: "price"},
+				{Type: TokenOperator, Value: "::"},
+				{Type: TokenIdentifier, Value: "INT"},
+				{Type: TokenKeyword, Value: "FROM"},
+				{Type: TokenIdentifier, Value: "t"},
+			},
+		},
+		{
+			name:  "array type",
+			input: "tags TEXT[]",
+			expected: []Token{
+				{Type: TokenIdentifier, Value: "tags"},
+				{Type: TokenIdentifier, Value: "TEXT"},
+				{Type: TokenSeparator, Value: "["},
+				{Type: TokenSeparator, Value: "]"},
+			},
+		},
+		{
+			name:  "bind parameters",
+			input: "a=$1 AND b = ? AND c = :name::INT",
+			expected: []Token{
+				{Type: TokenIdentifier, Value: "a"},
+				{Type: TokenOperator, Value: "="},
+				{Type: TokenParam, Value: "$1"},
+				{Type: TokenKeyword, Value: "AND"},
+				{Type: TokenIdentifier, Value: "b"},
+				{Type: TokenOperator, Value: "="},
+				{Type: TokenParam, Value: "?"},
+				{Type: TokenKeyword, Value: "AND"},
+				{Type: TokenIdentifier, Value: "c"},
+				{Type: TokenOperator, Value: "="},
+				{Type: TokenParam, Value: ":name"},
+				{Type: TokenOperator, Value: "::"},
+				{Type: TokenIdentifier, Value: "INT"},
+			},
+		},
+		{
+			name:  "comments are skipped",
+			input: "SELECT a -- the id\nFROM /* users */ t--x",
+			expected: []Token{
+				{Type: TokenKeyword, Value: "SELECT"},
+				{Type: TokenIdentifier, Value: "a"},
+				{Type: TokenKeyword, Value: "FROM"},
+				{Type: TokenIdentifier, Value: "t"},
+			},
+		},
+		{
+			name:  "doubled quotes in strings",
+			input: `'it''s' "say ""hi"""`,
+			expected: []Token{
+				{Type: TokenString, Value: "it's"},
+				{Type: TokenString, Value: `say "hi"`},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -248,3 +321,57 @@ func TestTokenizeTable(t *testing.T) {
 		})
 	}
 }
+
+func TestTokenizeSpans(t *testing.T) {
+	input := "SELECT a,b FROM t\nWHERE s = 'x y' AND p=$1"
+	tokens, spans := TokenizeSpans(input)
+	if !reflect.DeepEqual(tokens, Tokenize(input)) {
+		t.Fatalf("TokenizeSpans tokens differ from Tokenize")
+	}
+	if len(spans) != len(tokens) {
+		t.Fatalf("expected %d spans, got %d", len(tokens), len(spans))
+	}
+	want := []string{"SELECT", "a", ",", "b", "FROM", "t", "WHERE", "s", "=", "'x y'", "AND", "p", "=", "$1"}
+	for i, sp := range spans {
+		if got := input[sp.Start:sp.End]; got != want[i] {
+			t.Fatalf("span %d: expected %q, got %q", i, want[i], got)
+		}
+	}
+
+	// an unclosed string runs to the end of the input
+	_, spans = TokenizeSpans("SELECT 'open")
+	if last := spans[len(spans)-1]; last.Start != 7 || last.End != 12 {
+		t.Fatalf("unexpected span for unclosed string: %+v", last)
+	}
+}
+
+func TestTokenizeAll(t *testing.T) {
+	input := "SELECT a, -- id\r\n  '--x' /* b\n */FROM t /* open"
+	tokens, spans := TokenizeAll(input)
+	var text strings.Builder
+	var got []string
+	for i, tok := range tokens {
+		text.WriteString(input[spans[i].Start:spans[i].End])
+		if tok.Type == TokenWhitespace || tok.Type == TokenComment {
+			got = append(got, string(tok.Type)+":"+tok.Value)
+		}
+	}
+	if text.String() != input {
+		t.Fatalf("spans do not cover the input: %q", text.String())
+	}
+	want := []string{"WHITESPACE: ", "WHITESPACE: ", "COMMENT:-- id", "WHITESPACE:\r\n  ", "WHITESPACE: ", "COMMENT:/* b\n */", "WHITESPACE: ", "WHITESPACE: ", "COMMENT:/* open"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected trivia:\n got %q\nwant %q", got, want)
+	}
+
+	// without trivia the tokens match Tokenize
+	var plain []Token
+	for _, tok := range tokens {
+		if tok.Type != TokenWhitespace && tok.Type != TokenComment {
+			plain = append(plain, tok)
+		}
+	}
+	if !reflect.DeepEqual(plain, Tokenize(input)) {
+		t.Fatalf("TokenizeAll tokens differ from Tokenize")
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/vvshulga/db_internals/lexer"
@@ -9,13 +13,36 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: db_internals <query>")
+	if len(os.Args) >= 2 && os.Args[1] == "fmt" {
+		os.Exit(runFmt(os.Args[2:]))
+	}
+
+	asJSON := flag.Bool("json", false, "print only the AST, encoded as JSON")
+	asDOT := flag.Bool("dot", false, "print only the AST, as a Graphviz DOT graph")
+	flag.Usage = func() {
+		fmt.Println("Usage: db_internals [-json | -dot] <query>")
+		fmt.Println("       db_internals fmt [-l] [-w] [file.sql ...]")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || (*asJSON && *asDOT) {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	// Read all command line arguments after the program name
-	text := os.Args[1]
+	// Read the query following the flags
+	text := flag.Arg(0)
+	if *asJSON {
+		os.Exit(printJSON(text))
+	}
+	if *asDOT {
+		nodes, err := parser.ParseString(text)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Parse error:", err)
+			os.Exit(1)
+		}
+		fmt.Print(parser.ToDOT(nodes))
+		return
+	}
 	fmt.Println("Received query:", text)
 
 	// Tokenize the input
@@ -34,3 +61,97 @@ func main() {
 	fmt.Println("\nAST:")
 	fmt.Print(parser.PrintAST(nodes))
 }
+
+// printJSON parses text and prints its statements as an indented JSON array
+func printJSON(text string) int {
+	nodes, err := parser.ParseString(text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Parse error:", err)
+		return 1
+	}
+	data, err := parser.EncodeStatementsJSON(nodes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "JSON error:", err)
+		return 1
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		fmt.Fprintln(os.Stderr, "JSON error:", err)
+		return 1
+	}
+	fmt.Println(out.String())
+	return 0
+}
+
+// runFmt implements "db_internals fmt": it reformats SQL files with
+// parser.FormatScript and prints the result. With no files it formats
+// standard input.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	list := flags.Bool("l", false, "list files whose formatting differs")
+	write := flags.Bool("w", false, "write the result to the file instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "fmt:", err)
+			return 1
+		}
+		out, err := parser.FormatScript(string(src))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "<stdin>:", err)
+			return 1
+		}
+		switch {
+		case !*list:
+			fmt.Print(out)
+		case out != string(src):
+			fmt.Println("<stdin>")
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		if err := fmtFile(path, *list, *write); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func fmtFile(path string, list, write bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := parser.FormatScript(string(src))
+	if err != nil {
+		return err
+	}
+	if list && out != string(src) {
+		fmt.Println(path)
+	}
+	if write {
+		if out == string(src) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(out), info.Mode().Perm())
+	}
+	if !list {
+		fmt.Print(out)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/vvshulga/db_internals/lexer"
+)
+
+// CST is a lossless concrete syntax tree of a SQL script: every byte of the
+// source, whitespace and comments included, belongs to exactly one token
+// leaf, so the source text can be edited node by node without reformatting
+// anything else. Each CSTNode that covers an AST node links to it, and
+// Lookup maps AST nodes back to their CSTNode.
+type CST struct {
+	Source     string
+	Statements []Statement // the AST, as ParseString returns it
+	Root       *CSTNode    // covers the whole source
+	nodes      map[Node]*CSTNode
+}
+
+// CSTNode is a node of the concrete syntax tree. Inner nodes correspond to
+// AST nodes (or to the whole script for the root) and own the tokens between
+// their first and last token, including the trivia between them. Whitespace
+// and comments around a node belong to its parent. Leaves hold one token.
+type CSTNode struct {
+	Node     Node         // the AST node; nil for leaves and for the root
+	Token    *lexer.Token // the token of a leaf; nil for inner nodes
+	Span     lexer.Span   // byte range covered in the source
+	Parent   *CSTNode     // nil for the root
+	Children []*CSTNode   // in source order; nil for leaves
+	text     string       // source text of a leaf
+}
+
+// IsTrivia reports whether n is a whitespace or comment leaf
+func (n *CSTNode) IsTrivia() bool {
+	return n.Token != nil && (n.Token.Type == lexer.TokenWhitespace || n.Token.Type == lexer.TokenComment)
+}
+
+// Text returns the exact source text covered by n
+func (n *CSTNode) Text() string {
+	if n.Token != nil {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.Children {
+		b.WriteString(c.Text())
+	}
+	return b.String()
+}
+
+// Tokens returns the leaves under n in source order. Without trivia,
+// whitespace and comments are left out.
+func (n *CSTNode) Tokens(trivia bool) []*CSTNode {
+	if n.Token != nil {
+		if !trivia && n.IsTrivia() {
+			return nil
+		}
+		return []*CSTNode{n}
+	}
+	var out []*CSTNode
+	for _, c := range n.Children {
+		out = append(out, c.Tokens(trivia)...)
+	}
+	return out
+}
+
+// ParseCST parses input like ParseString and also builds its concrete
+// syntax tree
+func ParseCST(input string) (*CST, error) {
+	stmts, err := ParseString(input)
+	if err != nil {
+		return nil, err
+	}
+	tokens, spans := lexer.TokenizeAll(input)
+	b := &cstBuilder{src: input, tokens: tokens, spans: spans, nodes: map[Node]*CSTNode{}}
+	root := &CSTNode{Span: lexer.Span{Start: 0, End: len(input)}}
+	children := make([]Node, len(stmts))
+	for i, stmt := range stmts {
+		children[i] = stmt
+	}
+	b.fill(root, children, len(input))
+	return &CST{Source: input, Statements: stmts, Root: root, nodes: b.nodes}, nil
+}
+
+// Lookup returns the CSTNode covering an AST node of the tree, or nil if n
+// is not part of it
+func (c *CST) Lookup(n Node) *CSTNode {
+	return c.nodes[n]
+}
+
+// NodeAt returns the innermost AST node whose tokens cover the byte offset,
+// or nil when the offset falls outside every statement or on the trivia
+// between statements
+func (c *CST) NodeAt(offset int) Node {
+	var found Node
+	cur := c.Root
+	for cur != nil {
+		next := (*CSTNode)(nil)
+		for _, child := range cur.Children {
+			if child.Node != nil && offset >= child.Span.Start && offset < child.Span.End {
+				found, next = child.Node, child
+				break
+			}
+		}
+		cur = next
+	}
+	return found
+}
+
+// Replace returns the source with the text of AST node n replaced by text,
+// leaving every other byte untouched. The result is not re-parsed.
+func (c *CST) Replace(n Node, text string) (string, error) {
+	cn := c.Lookup(n)
+	if cn == nil {
+		return "", fmt.Errorf("%T is not part of this syntax tree", n)
+	}
+	return c.Source[:cn.Span.Start] + text + c.Source[cn.Span.End:], nil
+}
+
+type cstBuilder struct {
+	src    string
+	tokens []lexer.Token
+	spans  []lexer.Span
+	next   int // index of the next unconsumed token
+	nodes  map[Node]*CSTNode
+}
+
+// fill appends to parent the tokens up to offset end, descending into the
+// AST children when their first token is reached
+func (b *cstBuilder) fill(parent *CSTNode, children []Node, end int) {
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Pos().Offset < children[j].Pos().Offset
+	})
+	k := 0
+	for b.next < len(b.tokens) && b.spans[b.next].Start < end {
+		start := b.spans[b.next].Start
+		// children without tokens (never produced by the parser) are skipped
+		for k < len(children) && children[k].End().Offset <= children[k].Pos().Offset {
+			k++
+		}
+		if k < len(children) && start >= children[k].Pos().Offset {
+			parent.Children = append(parent.Children, b.node(children[k], parent))
+			k++
+			continue
+		}
+		span := b.spans[b.next]
+		parent.Children = append(parent.Children, &CSTNode{
+			Token:  &b.tokens[b.next],
+			Span:   span,
+			Parent: parent,
+			text:   b.src[span.Start:span.End],
+		})
+		b.next++
+	}
+}
+
+func (b *cstBuilder) node(n Node, parent *CSTNode) *CSTNode {
+	cn := &CSTNode{
+		Node:   n,
+		Span:   lexer.Span{Start: n.Pos().Offset, End: n.End().Offset},
+		Parent: parent,
+	}
+	var children []Node
+	rewriteChildren(n, func(child Node) Node {
+		children = append(children, child)
+		return child
+	})
+	b.fill(cn, children, cn.Span.End)
+	b.nodes[n] = cn
+	return cn
+}
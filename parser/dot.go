@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	statementInterface = reflect.TypeOf((*Statement)(nil)).Elem()
+	dataTypeType       = reflect.TypeOf(DataType{})
+)
+
+// ToDOT renders statements as a Graphviz DOT digraph, for example to pipe
+// into dot -Tsvg. Statements are drawn as boxes, clauses such as projections
+// or column definitions as rounded boxes and expressions as ellipses. Each
+// graph node lists its type and its non-empty scalar fields; edges are
+// labelled with the field (and index) that holds the child, using the same
+// snake_case names as EncodeJSON.
+func ToDOT(nodes []Statement) string {
+	g := &dotGraph{}
+	g.b.WriteString("digraph AST {\n")
+	g.b.WriteString("\tnode [fontname=\"Helvetica\"];\n")
+	g.b.WriteString("\tedge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, n := range nodes {
+		g.add(reflect.ValueOf(n))
+	}
+	g.b.WriteString("}\n")
+	return g.b.String()
+}
+
+type dotGraph struct {
+	b    strings.Builder
+	next int
+}
+
+type dotChild struct {
+	label string
+	value reflect.Value
+}
+
+// add writes v, a node pointer or a clause struct, and everything below it
+// to the graph and returns its id
+func (g *dotGraph) add(v reflect.Value) string {
+	for v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	shape := "shape=box, style=rounded"
+	if v.Kind() == reflect.Ptr {
+		if v.Type().Implements(statementInterface) {
+			shape = "shape=box"
+		} else if v.Type().Implements(nodeInterface) {
+			shape = "shape=ellipse"
+		}
+		v = v.Elem()
+	}
+	id := "n" + strconv.Itoa(g.next)
+	g.next++
+
+	t := v.Type()
+	lines := []string{t.Name()}
+	var children []dotChild
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key := jsonFieldName(t, f)
+		fv := v.Field(i)
+		if s, ok := dotScalar(fv); ok {
+			if s != "" {
+				lines = append(lines, key+": "+s)
+			}
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if !fv.IsNil() {
+				children = append(children, dotChild{key, fv})
+			}
+		case reflect.Struct:
+			children = append(children, dotChild{key, fv})
+		case reflect.Slice:
+			for j := 0; j < fv.Len(); j++ {
+				children = append(children, dotChild{fmt.Sprintf("%s[%d]", key, j), fv.Index(j)})
+			}
+		}
+	}
+
+	fmt.Fprintf(&g.b, "\t%s [label=%s, %s];\n", id, dotQuote(strings.Join(lines, "\n")), shape)
+	for _, c := range children {
+		child := g.add(c.value)
+		fmt.Fprintf(&g.b, "\t%s -> %s [label=%s];\n", id, child, dotQuote(c.label))
+	}
+	return id
+}
+
+// dotScalar renders a field that is shown inside its node's label rather
+// than as a child. Empty strings, false, zero ints and absent values render
+// as "".
+func dotScalar(v reflect.Value) (string, bool) {
+	switch {
+	case v.Type() == dataTypeType:
+		if v.Field(0).String() == "" {
+			return "", true
+		}
+		return v.Interface().(DataType).String(), true
+	case v.Kind() == reflect.String:
+		return v.String(), true
+	case v.Kind() == reflect.Bool:
+		if v.Bool() {
+			return "true", true
+		}
+		return "", true
+	case v.Kind() == reflect.Int:
+		if v.Int() == 0 {
+			return "", true
+		}
+		return strconv.FormatInt(v.Int(), 10), true
+	case v.Kind() == reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Uint64:
+		if v.IsNil() {
+			return "", true
+		}
+		return strconv.FormatUint(v.Elem().Uint(), 10), true
+	case v.Kind() == reflect.Slice && (v.Type().Elem().Kind() == reflect.String || v.Type().Elem() == dataTypeType):
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i], _ = dotScalar(v.Index(i))
+		}
+		return strings.Join(items, ", "), true
+	}
+	return "", false
+}
+
+// dotQuote quotes s as a DOT string, turning newlines into centred line
+// breaks
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\r", "")
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
@@ -0,0 +1,604 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format renders a statement or expression as canonical SQL: upper-case
+// keywords, single spaces, single-quoted strings with embedded quotes
+// doubled, and only the parentheses needed to preserve the tree's shape.
+// Identifiers are written as parsed, since the lexer has no quoted
+// identifiers. For ASTs produced by ParseString, parsing the result yields
+// the same tree.
+func Format(n Node) string {
+	switch x := n.(type) {
+	case Statement:
+		return sqlStatement(x)
+	case Expr:
+		return sqlExpr(x)
+	}
+	panic(fmt.Sprintf("parser: cannot format %T", n))
+}
+
+func sqlStatement(n Statement) string {
+	switch x := n.(type) {
+	case *SelectStmt:
+		return sqlSelect(x)
+	case *InsertStmt:
+		return sqlInsert(x)
+	case *UpdateStmt:
+		out := sqlWith(x.With) + "UPDATE " + x.TableName + " SET " + sqlAssignments(x.Set)
+		return out + sqlWhere(x.Selection) + sqlReturning(x.Returning)
+	case *DeleteStmt:
+		out := sqlWith(x.With) + "DELETE FROM " + x.TableName
+		return out + sqlWhere(x.Selection) + sqlReturning(x.Returning)
+	case *CreateTableStmt:
+		return sqlCreateTable(x)
+	case *AlterTableStmt:
+		actions := make([]string, len(x.Actions))
+		for i, a := range x.Actions {
+			actions[i] = sqlAlterTableAction(a)
+		}
+		return "ALTER TABLE " + x.TableName + " " + strings.Join(actions, ", ")
+	case *CreateIndexStmt:
+		return sqlCreateIndex(x)
+	case *DropIndexStmt:
+		if x.IfExists {
+			return "DROP INDEX IF EXISTS " + x.Name
+		}
+		return "DROP INDEX " + x.Name
+	case *CreateViewStmt:
+		return sqlViewHead(x) + " AS " + sqlSelect(x.Query)
+	case *RefreshMaterializedViewStmt:
+		return "REFRESH MATERIALIZED VIEW " + x.Name
+	case *BeginStmt:
+		if x.IsolationLevel != "" {
+			return "BEGIN ISOLATION LEVEL " + x.IsolationLevel
+		}
+		return "BEGIN"
+	case *CommitStmt:
+		return "COMMIT"
+	case *RollbackStmt:
+		if x.Savepoint != "" {
+			return "ROLLBACK TO SAVEPOINT " + x.Savepoint
+		}
+		return "ROLLBACK"
+	case *SavepointStmt:
+		return "SAVEPOINT " + x.Name
+	case *ReleaseSavepointStmt:
+		return "RELEASE SAVEPOINT " + x.Name
+	case *PrepareStmt:
+		return sqlPrepareHead(x) + " AS " + sqlStatement(x.Statement)
+	case *ExecuteStmt:
+		if len(x.Args) == 0 {
+			return "EXECUTE " + x.Name
+		}
+		return "EXECUTE " + x.Name + " (" + sqlOperands(x.Args) + ")"
+	case *DeallocateStmt:
+		if x.All {
+			return "DEALLOCATE ALL"
+		}
+		return "DEALLOCATE " + x.Name
+	case *ExplainStmt:
+		return sqlExplainHead(x) + " " + sqlStatement(x.Statement)
+	}
+	panic(fmt.Sprintf("parser: cannot format statement %T", n))
+}
+
+// setOpPrecedence returns how tightly a compound query's operator binds
+func setOpPrecedence(s *SelectStmt) int {
+	if s.SetOp.Op == "INTERSECT" {
+		return 2
+	}
+	return 1
+}
+
+func sqlSelect(s *SelectStmt) string {
+	var b strings.Builder
+	b.WriteString(sqlWith(s.With))
+	if s.SetOp != nil {
+		prec := setOpPrecedence(s)
+		b.WriteString(sqlSetOperand(s.SetOp.Left, prec, false))
+		b.WriteString(" " + s.SetOp.Op)
+		if s.SetOp.All {
+			b.WriteString(" ALL")
+		}
+		b.WriteString(" " + sqlSetOperand(s.SetOp.Right, prec, true))
+	} else {
+		b.WriteString("SELECT " + sqlProjections(s.Projections))
+		b.WriteString(" FROM " + sqlTableRef(s.From))
+		b.WriteString(sqlWhere(s.Selection))
+		if len(s.Windows) > 0 {
+			windows := make([]string, len(s.Windows))
+			for i, w := range s.Windows {
+				windows[i] = w.Name + " AS (" + sqlWindowSpec(&w.Spec) + ")"
+			}
+			b.WriteString(" WINDOW " + strings.Join(windows, ", "))
+		}
+	}
+	if len(s.OrderBy) > 0 {
+		b.WriteString(" ORDER BY " + sqlOrderBy(s.OrderBy))
+	}
+	if s.Limit != nil {
+		b.WriteString(fmt.Sprintf(" LIMIT %d", *s.Limit))
+	}
+	return b.String()
+}
+
+// sqlSetOperand renders one side of a set operation, parenthesized when it
+// carries its own WITH, ORDER BY or LIMIT or binds looser than its parent.
+// Set operations are left-associative, so a right operand of equal
+// precedence needs parentheses too.
+func sqlSetOperand(s *SelectStmt, parentPrec int, right bool) string {
+	if setOperandNeedsParens(s, parentPrec, right) {
+		return "(" + sqlSelect(s) + ")"
+	}
+	return sqlSelect(s)
+}
+
+func setOperandNeedsParens(s *SelectStmt, parentPrec int, right bool) bool {
+	if s.With != nil || len(s.OrderBy) > 0 || s.Limit != nil {
+		return true
+	}
+	if s.SetOp == nil {
+		return false
+	}
+	prec := setOpPrecedence(s)
+	return prec < parentPrec || (right && prec == parentPrec)
+}
+
+func sqlWith(w *WithClause) string {
+	if w == nil {
+		return ""
+	}
+	ctes := make([]string, len(w.CTEs))
+	for i, cte := range w.CTEs {
+		ctes[i] = sqlCTEHead(cte) + " AS (" + sqlSelect(cte.Query) + ")"
+	}
+	if w.Recursive {
+		return "WITH RECURSIVE " + strings.Join(ctes, ", ") + " "
+	}
+	return "WITH " + strings.Join(ctes, ", ") + " "
+}
+
+func sqlCTEHead(cte CommonTableExpr) string {
+	if len(cte.Columns) > 0 {
+		return cte.Name + " (" + strings.Join(cte.Columns, ", ") + ")"
+	}
+	return cte.Name
+}
+
+func sqlProjections(items []ProjectionItem) string {
+	out := make([]string, len(items))
+	for i, p := range items {
+		out[i] = sqlProjection(p)
+	}
+	return strings.Join(out, ", ")
+}
+
+func sqlProjection(p ProjectionItem) string {
+	out := p.Column
+	switch {
+	case p.All:
+		out = "*"
+	case p.Expr != nil:
+		out = sqlOperand(p.Expr)
+	}
+	if p.Alias != "" {
+		out += " AS " + p.Alias
+	}
+	return out
+}
+
+func sqlTableRef(t TableRef) string {
+	out := t.Name
+	if t.Subquery != nil {
+		out = "(" + sqlSelect(t.Subquery) + ")"
+	}
+	if t.Alias != "" {
+		out += " AS " + t.Alias
+	}
+	return out
+}
+
+func sqlWhere(e Expr) string {
+	if e == nil {
+		return ""
+	}
+	return " WHERE " + sqlExpr(e)
+}
+
+func sqlReturning(items []ProjectionItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return " RETURNING " + sqlProjections(items)
+}
+
+func sqlOrderBy(items []OrderByItem) string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = sqlOrderByItem(item)
+	}
+	return strings.Join(out, ", ")
+}
+
+func sqlOrderByItem(item OrderByItem) string {
+	if item.Desc {
+		return sqlOperand(item.Expr) + " DESC"
+	}
+	return sqlOperand(item.Expr)
+}
+
+func sqlWindowSpec(w *WindowSpec) string {
+	var parts []string
+	if w.Name != "" {
+		parts = append(parts, w.Name)
+	}
+	if len(w.PartitionBy) > 0 {
+		parts = append(parts, "PARTITION BY "+sqlOperands(w.PartitionBy))
+	}
+	if len(w.OrderBy) > 0 {
+		parts = append(parts, "ORDER BY "+sqlOrderBy(w.OrderBy))
+	}
+	if w.Frame != nil {
+		if w.Frame.End != nil {
+			parts = append(parts, w.Frame.Unit+" BETWEEN "+sqlFrameBound(w.Frame.Start)+" AND "+sqlFrameBound(*w.Frame.End))
+		} else {
+			parts = append(parts, w.Frame.Unit+" "+sqlFrameBound(w.Frame.Start))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func sqlFrameBound(b FrameBound) string {
+	if b.Offset != nil {
+		return sqlOperand(b.Offset) + " " + b.Kind
+	}
+	return b.Kind
+}
+
+func sqlInsert(ins *InsertStmt) string {
+	out := sqlWith(ins.With) + "INSERT INTO " + ins.TableName
+	if len(ins.Columns) > 0 {
+		out += " (" + strings.Join(ins.Columns, ", ") + ")"
+	}
+	out += " VALUES (" + sqlOperands(ins.Values) + ")"
+	if ins.OnConflict != nil {
+		out += " " + sqlOnConflict(ins.OnConflict)
+	}
+	return out + sqlReturning(ins.Returning)
+}
+
+func sqlOnConflict(oc *OnConflict) string {
+	out := "ON CONFLICT"
+	if len(oc.Columns) > 0 {
+		out += " (" + strings.Join(oc.Columns, ", ") + ")"
+	}
+	if oc.Constraint != "" {
+		out += " ON CONSTRAINT " + oc.Constraint
+	}
+	if oc.DoNothing {
+		return out + " DO NOTHING"
+	}
+	return out + " DO UPDATE SET " + sqlAssignments(oc.Set) + sqlWhere(oc.Where)
+}
+
+func sqlAssignments(set []Assignment) string {
+	out := make([]string, len(set))
+	for i, a := range set {
+		out[i] = sqlAssignment(a)
+	}
+	return strings.Join(out, ", ")
+}
+
+func sqlAssignment(a Assignment) string {
+	return a.Column + " = " + sqlOperand(a.Value)
+}
+
+func sqlCreateTable(ct *CreateTableStmt) string {
+	if ct.AsSelect != nil {
+		return sqlCreateTableHead(ct) + " AS " + sqlSelect(ct.AsSelect)
+	}
+	return sqlCreateTableHead(ct) + " (" + strings.Join(sqlTableElements(ct), ", ") + ")"
+}
+
+func sqlCreateTableHead(ct *CreateTableStmt) string {
+	if ct.IfNotExists {
+		return "CREATE TABLE IF NOT EXISTS " + ct.TableName
+	}
+	return "CREATE TABLE " + ct.TableName
+}
+
+// sqlTableElements renders the column definitions followed by the table
+// constraints of a CREATE TABLE
+func sqlTableElements(ct *CreateTableStmt) []string {
+	var elems []string
+	for _, c := range ct.Columns {
+		elems = append(elems, sqlColumnDef(c))
+	}
+	for _, c := range ct.Constraints {
+		elems = append(elems, sqlTableConstraint(c))
+	}
+	return elems
+}
+
+func sqlColumnDef(c ColumnDef) string {
+	out := c.Name + " " + c.Type.String()
+	if c.PrimaryKey {
+		out += " PRIMARY KEY"
+	}
+	if c.NotNull {
+		out += " NOT NULL"
+	}
+	if c.Null {
+		out += " NULL"
+	}
+	if c.Unique {
+		out += " UNIQUE"
+	}
+	if c.Default != nil {
+		out += " DEFAULT " + sqlOperand(c.Default)
+	}
+	if c.Check != nil {
+		out += " CHECK (" + sqlExpr(c.Check) + ")"
+	}
+	if c.References != nil {
+		out += " " + sqlReferences(c.References)
+	}
+	return out
+}
+
+func sqlReferences(r *References) string {
+	out := "REFERENCES " + r.Table
+	if len(r.Columns) > 0 {
+		out += " (" + strings.Join(r.Columns, ", ") + ")"
+	}
+	if r.OnDelete != "" {
+		out += " ON DELETE " + r.OnDelete
+	}
+	if r.OnUpdate != "" {
+		out += " ON UPDATE " + r.OnUpdate
+	}
+	return out
+}
+
+func sqlTableConstraint(c TableConstraint) string {
+	out := ""
+	if c.Name != "" {
+		out = "CONSTRAINT " + c.Name + " "
+	}
+	if c.Type == "CHECK" {
+		return out + "CHECK (" + sqlExpr(c.Check) + ")"
+	}
+	out += c.Type + " (" + strings.Join(c.Columns, ", ") + ")"
+	if c.References != nil {
+		out += " " + sqlReferences(c.References)
+	}
+	return out
+}
+
+func sqlAlterTableAction(a AlterTableAction) string {
+	ifExists := ""
+	if a.IfExists {
+		ifExists = "IF EXISTS "
+	}
+	switch a.Type {
+	case "ADD COLUMN":
+		return "ADD COLUMN " + sqlColumnDef(*a.Column)
+	case "DROP COLUMN":
+		return "DROP COLUMN " + ifExists + a.ColumnName
+	case "RENAME COLUMN":
+		return "RENAME COLUMN " + a.ColumnName + " TO " + a.NewName
+	case "RENAME TO":
+		return "RENAME TO " + a.NewName
+	case "ALTER COLUMN TYPE":
+		return "ALTER COLUMN " + a.ColumnName + " TYPE " + a.DataType.String()
+	case "SET DEFAULT":
+		return "ALTER COLUMN " + a.ColumnName + " SET DEFAULT " + sqlOperand(a.Default)
+	case "DROP DEFAULT", "SET NOT NULL", "DROP NOT NULL":
+		return "ALTER COLUMN " + a.ColumnName + " " + a.Type
+	case "ADD CONSTRAINT":
+		return "ADD " + sqlTableConstraint(*a.Constraint)
+	case "DROP CONSTRAINT":
+		return "DROP CONSTRAINT " + ifExists + a.ConstraintName
+	}
+	panic(fmt.Sprintf("parser: unknown ALTER TABLE action %q", a.Type))
+}
+
+func sqlCreateIndex(ci *CreateIndexStmt) string {
+	out := "CREATE "
+	if ci.Unique {
+		out += "UNIQUE "
+	}
+	out += "INDEX "
+	if ci.IfNotExists {
+		out += "IF NOT EXISTS "
+	}
+	cols := make([]string, len(ci.Columns))
+	for i, c := range ci.Columns {
+		cols[i] = c.Name
+		if c.Desc {
+			cols[i] += " DESC"
+		}
+	}
+	out += ci.Name + " ON " + ci.TableName + " (" + strings.Join(cols, ", ") + ")"
+	return out + sqlWhere(ci.Where)
+}
+
+func sqlViewHead(v *CreateViewStmt) string {
+	out := "CREATE "
+	if v.OrReplace {
+		out += "OR REPLACE "
+	}
+	if v.Materialized {
+		out += "MATERIALIZED "
+	}
+	out += "VIEW " + v.Name
+	if len(v.Columns) > 0 {
+		out += " (" + strings.Join(v.Columns, ", ") + ")"
+	}
+	return out
+}
+
+func sqlPrepareHead(ps *PrepareStmt) string {
+	if len(ps.ParamTypes) == 0 {
+		return "PREPARE " + ps.Name
+	}
+	types := make([]string, len(ps.ParamTypes))
+	for i, t := range ps.ParamTypes {
+		types[i] = t.String()
+	}
+	return "PREPARE " + ps.Name + " (" + strings.Join(types, ", ") + ")"
+}
+
+// sqlExplainHead renders EXPLAIN and its options, using the parenthesized
+// option list only when FORMAT is given
+func sqlExplainHead(es *ExplainStmt) string {
+	if es.Format == "" {
+		out := "EXPLAIN"
+		if es.Analyze {
+			out += " ANALYZE"
+		}
+		if es.Verbose {
+			out += " VERBOSE"
+		}
+		return out
+	}
+	var opts []string
+	if es.Analyze {
+		opts = append(opts, "ANALYZE")
+	}
+	if es.Verbose {
+		opts = append(opts, "VERBOSE")
+	}
+	opts = append(opts, "FORMAT "+es.Format)
+	return "EXPLAIN (" + strings.Join(opts, ", ") + ")"
+}
+
+// isCondition reports whether e is a predicate or boolean combination,
+// which the grammar only accepts where a condition is expected
+func isCondition(e Expr) bool {
+	switch e.(type) {
+	case *LogicalOp, *ComparisonOp, *InExpr, *BetweenExpr, *LikeExpr, *ExistsExpr:
+		return true
+	}
+	return false
+}
+
+// sqlOperand renders e where the grammar expects an operand, parenthesizing
+// conditions and binary expressions
+func sqlOperand(e Expr) string {
+	if _, ok := e.(*BinaryOp); ok || isCondition(e) {
+		return "(" + sqlExpr(e) + ")"
+	}
+	return sqlExpr(e)
+}
+
+func sqlOperands(list []Expr) string {
+	out := make([]string, len(list))
+	for i, e := range list {
+		out[i] = sqlOperand(e)
+	}
+	return strings.Join(out, ", ")
+}
+
+// sqlLogicalOperand renders a child of an AND/OR. AND and OR chains are
+// left-associative and mixing them always gets parentheses, so the output
+// reads the same under the usual AND-before-OR precedence.
+func sqlLogicalOperand(e Expr, parentOp string, right bool) string {
+	if l, ok := e.(*LogicalOp); ok && (l.Op != parentOp || right) {
+		return "(" + sqlExpr(e) + ")"
+	}
+	return sqlExpr(e)
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func sqlExpr(e Expr) string {
+	switch x := e.(type) {
+	case *ColumnRef:
+		return x.Name
+	case *LiteralInt:
+		return fmt.Sprintf("%d", x.Value)
+	case *LiteralString:
+		return quoteString(x.Value)
+	case *LiteralNull:
+		return "NULL"
+	case *Param:
+		return formatParam(x)
+	case *LogicalOp:
+		return sqlLogicalOperand(x.Left, x.Op, false) + " " + x.Op + " " + sqlLogicalOperand(x.Right, x.Op, true)
+	case *ComparisonOp:
+		return sqlOperand(x.Left) + " " + x.Op + " " + sqlOperand(x.Right)
+	case *BinaryOp:
+		return sqlOperand(x.Left) + " " + x.Op + " " + sqlOperand(x.Right)
+	case *SubqueryExpr:
+		return "(" + sqlSelect(x.Select) + ")"
+	case *ExistsExpr:
+		if x.Not {
+			return "NOT EXISTS (" + sqlSelect(x.Subquery) + ")"
+		}
+		return "EXISTS (" + sqlSelect(x.Subquery) + ")"
+	case *InExpr:
+		op := " IN ("
+		if x.Not {
+			op = " NOT IN ("
+		}
+		if x.Subquery != nil {
+			return sqlOperand(x.Left) + op + sqlSelect(x.Subquery) + ")"
+		}
+		return sqlOperand(x.Left) + op + sqlOperands(x.List) + ")"
+	case *BetweenExpr:
+		op := " BETWEEN "
+		if x.Not {
+			op = " NOT BETWEEN "
+		}
+		return sqlOperand(x.Expr) + op + sqlOperand(x.Low) + " AND " + sqlOperand(x.High)
+	case *LikeExpr:
+		op := " " + x.Op + " "
+		if x.Not {
+			op = " NOT " + x.Op + " "
+		}
+		out := sqlOperand(x.Left) + op + sqlOperand(x.Pattern)
+		if x.Escape != nil {
+			out += " ESCAPE " + sqlExpr(x.Escape)
+		}
+		return out
+	case *CaseExpr:
+		out := "CASE"
+		if x.Operand != nil {
+			out += " " + sqlOperand(x.Operand)
+		}
+		for _, w := range x.Whens {
+			cond := sqlExpr(w.Cond)
+			if x.Operand != nil {
+				cond = sqlOperand(w.Cond)
+			}
+			out += " WHEN " + cond + " THEN " + sqlOperand(w.Result)
+		}
+		if x.Else != nil {
+			out += " ELSE " + sqlOperand(x.Else)
+		}
+		return out + " END"
+	case *CastExpr:
+		return "CAST(" + sqlOperand(x.Expr) + " AS " + x.Type.String() + ")"
+	case *FuncCall:
+		args := sqlOperands(x.Args)
+		if x.Star {
+			args = "*"
+		}
+		out := x.Name + "(" + args + ")"
+		if x.Over != nil {
+			if x.Over.Name != "" && len(x.Over.PartitionBy) == 0 && len(x.Over.OrderBy) == 0 && x.Over.Frame == nil {
+				return out + " OVER " + x.Over.Name
+			}
+			out += " OVER (" + sqlWindowSpec(x.Over) + ")"
+		}
+		return out
+	}
+	panic(fmt.Sprintf("parser: cannot format expression %T", e))
+}
@@ -0,0 +1,397 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// nodeTypes maps the "type" discriminator of a JSON node to its Go type
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, n := range []Node{
+		&SelectStmt{}, &InsertStmt{}, &UpdateStmt{}, &DeleteStmt{}, &CreateTableStmt{},
+		&AlterTableStmt{}, &CreateIndexStmt{}, &DropIndexStmt{}, &CreateViewStmt{},
+		&RefreshMaterializedViewStmt{}, &BeginStmt{}, &CommitStmt{}, &RollbackStmt{},
+		&SavepointStmt{}, &ReleaseSavepointStmt{}, &PrepareStmt{}, &ExecuteStmt{},
+		&DeallocateStmt{}, &ExplainStmt{},
+		&ColumnRef{}, &LiteralInt{}, &LiteralString{}, &LiteralNull{}, &BinaryOp{},
+		&LogicalOp{}, &ComparisonOp{}, &SubqueryExpr{}, &ExistsExpr{}, &InExpr{},
+		&BetweenExpr{}, &LikeExpr{}, &CaseExpr{}, &FuncCall{}, &Param{}, &CastExpr{},
+	} {
+		t := reflect.TypeOf(n).Elem()
+		nodeTypes[t.Name()] = t
+	}
+}
+
+// jsonFieldOverrides names the fields whose JSON key is not the snake_case
+// form of the Go name. No field is keyed "type", so it cannot be confused
+// with the discriminator of a node.
+var jsonFieldOverrides = map[string]string{
+	"WithClause.CTEs":       "ctes",
+	"CastExpr.Type":         "data_type",
+	"ColumnDef.Type":        "data_type",
+	"TableConstraint.Type":  "constraint_type",
+	"AlterTableAction.Type": "action",
+}
+
+var nodeInterface = reflect.TypeOf((*Node)(nil)).Elem()
+
+// EncodeJSON encodes a statement or expression as JSON. Every node is an
+// object whose "type" is the Go type name (e.g. "SelectStmt"), "pos" and
+// "end" are its Pos and End as {"offset", "line", "column"} or null, and
+// every other key is a field in snake_case (e.g. "table_name"), in
+// declaration order. Clauses such as ProjectionItem are plain objects
+// without "type". Absent optional values are null, and all fields are
+// always present.
+func EncodeJSON(n Node) ([]byte, error) {
+	var b bytes.Buffer
+	if err := encodeJSONValue(&b, reflect.ValueOf(n)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// EncodeStatementsJSON encodes statements as a JSON array of nodes
+func EncodeStatementsJSON(stmts []Statement) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('[')
+	for i, stmt := range stmts {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := encodeJSONValue(&b, reflect.ValueOf(stmt)); err != nil {
+			return nil, err
+		}
+	}
+	b.WriteByte(']')
+	return b.Bytes(), nil
+}
+
+func encodeJSONValue(b *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		if v.Type().Implements(nodeInterface) {
+			return encodeJSONNode(b, v)
+		}
+		return encodeJSONValue(b, v.Elem())
+	case reflect.Struct:
+		b.WriteByte('{')
+		err := encodeJSONFields(b, v, false)
+		b.WriteByte('}')
+		return err
+	case reflect.Slice:
+		if v.IsNil() {
+			b.WriteString("null")
+			return nil
+		}
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := encodeJSONValue(b, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+		return nil
+	case reflect.String:
+		return encodeJSONString(b, v.String())
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+		return nil
+	case reflect.Int, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+		return nil
+	case reflect.Uint64:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+		return nil
+	}
+	return fmt.Errorf("cannot encode %s as JSON", v.Type())
+}
+
+// encodeJSONString writes s as a JSON string, leaving <, > and & unescaped
+// so operators stay readable
+func encodeJSONString(b *bytes.Buffer, s string) error {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	// Encode terminates the value with a newline
+	b.Truncate(b.Len() - 1)
+	return nil
+}
+
+func encodeJSONNode(b *bytes.Buffer, v reflect.Value) error {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	n := v.Interface().(Node)
+	fmt.Fprintf(b, `{"type":%q,"pos":`, v.Elem().Type().Name())
+	encodeJSONPos(b, n.Pos())
+	b.WriteString(`,"end":`)
+	encodeJSONPos(b, n.End())
+	err := encodeJSONFields(b, v.Elem(), true)
+	b.WriteByte('}')
+	return err
+}
+
+func encodeJSONPos(b *bytes.Buffer, p Pos) {
+	if !p.IsValid() {
+		b.WriteString("null")
+		return
+	}
+	fmt.Fprintf(b, `{"offset":%d,"line":%d,"column":%d}`, p.Offset, p.Line, p.Column)
+}
+
+// encodeJSONFields writes the exported fields of struct v as object members,
+// preceded by a comma when the object already has members
+func encodeJSONFields(b *bytes.Buffer, v reflect.Value, comma bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if comma {
+			b.WriteByte(',')
+		}
+		comma = true
+		fmt.Fprintf(b, "%q:", jsonFieldName(t, f))
+		if err := encodeJSONValue(b, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeJSON decodes a node produced by EncodeJSON
+func DecodeJSON(data []byte) (Node, error) {
+	raw, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONNode(raw)
+}
+
+// DecodeStatementsJSON decodes an array produced by EncodeStatementsJSON
+func DecodeStatementsJSON(data []byte) ([]Statement, error) {
+	raw, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON array of statements")
+	}
+	stmts := make([]Statement, len(list))
+	for i, item := range list {
+		n, err := decodeJSONNode(item)
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %v", i, err)
+		}
+		stmt, ok := n.(Statement)
+		if !ok {
+			return nil, fmt.Errorf("statement %d: %T is not a statement", i, n)
+		}
+		stmts[i] = stmt
+	}
+	return stmts, nil
+}
+
+func parseJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func decodeJSONNode(raw interface{}) (Node, error) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a node object, got %s", jsonKind(raw))
+	}
+	name, _ := obj["type"].(string)
+	t, ok := nodeTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown node type %q", name)
+	}
+	v := reflect.New(t)
+	if err := decodeJSONFields(obj, v.Elem(), true); err != nil {
+		return nil, err
+	}
+	n := v.Interface().(Node)
+	var pos, end Pos
+	if err := decodeJSONValue(obj["pos"], reflect.ValueOf(&pos).Elem()); err != nil {
+		return nil, fmt.Errorf("%s.pos: %v", name, err)
+	}
+	if err := decodeJSONValue(obj["end"], reflect.ValueOf(&end).Elem()); err != nil {
+		return nil, fmt.Errorf("%s.end: %v", name, err)
+	}
+	n.setPos(pos)
+	n.setEnd(end)
+	return n, nil
+}
+
+func decodeJSONFields(obj map[string]interface{}, v reflect.Value, isNode bool) error {
+	t := v.Type()
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() {
+			fields[jsonFieldName(t, f)] = i
+		}
+	}
+	for key, raw := range obj {
+		if isNode && (key == "type" || key == "pos" || key == "end") {
+			continue
+		}
+		i, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown field %q in %s", key, t.Name())
+		}
+		if err := decodeJSONValue(raw, v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %v", t.Name(), key, err)
+		}
+	}
+	return nil
+}
+
+func decodeJSONValue(raw interface{}, v reflect.Value) error {
+	if raw == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.Type().Implements(nodeInterface) {
+			n, err := decodeJSONNode(raw)
+			if err != nil {
+				return err
+			}
+			nv := reflect.ValueOf(n)
+			if !nv.Type().AssignableTo(v.Type()) {
+				return fmt.Errorf("%T cannot be used as %s", n, v.Type())
+			}
+			v.Set(nv)
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := decodeJSONValue(raw, p.Elem()); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object, got %s", jsonKind(raw))
+		}
+		return decodeJSONFields(obj, v, false)
+	case reflect.Slice:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected an array, got %s", jsonKind(raw))
+		}
+		s := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := decodeJSONValue(item, s.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+		v.Set(s)
+		return nil
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", jsonKind(raw))
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return fmt.Errorf("expected a boolean, got %s", jsonKind(raw))
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int64:
+		num, ok := raw.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected a number, got %s", jsonKind(raw))
+		}
+		n, err := strconv.ParseInt(string(num), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %s", num)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint64:
+		num, ok := raw.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected a number, got %s", jsonKind(raw))
+		}
+		n, err := strconv.ParseUint(string(num), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %s", num)
+		}
+		v.SetUint(n)
+		return nil
+	}
+	return fmt.Errorf("cannot decode JSON into %s", v.Type())
+}
+
+// jsonKind describes a decoded JSON value for error messages
+func jsonKind(raw interface{}) string {
+	switch raw.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return "null"
+}
+
+// jsonFieldName returns the JSON key of field f of struct type t
+func jsonFieldName(t reflect.Type, f reflect.StructField) string {
+	if name, ok := jsonFieldOverrides[t.Name()+"."+f.Name]; ok {
+		return name
+	}
+	return snakeCase(f.Name)
+}
+
+// snakeCase converts a Go identifier such as IfNotExists to if_not_exists
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vvshulga/db_internals/lexer"
+)
+
+// Pos is a position in the query text. Line and Column are 1-based and count
+// bytes; the zero Pos means the position is unknown.
+type Pos struct {
+	Offset int // byte offset
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Node is implemented by every statement and expression in the AST.
+// Pos is the position of the node's first token and End the position just
+// past its last one; String renders the node the way PrintAST does.
+type Node interface {
+	Pos() Pos
+	End() Pos
+	String() string
+	setPos(Pos)
+	setEnd(Pos)
+}
+
+// Statement is a top-level SQL statement. Only types in this package
+// implement it.
+type Statement interface {
+	Node
+	statementNode()
+}
+
+// Expr is a scalar or boolean expression. Only types in this package
+// implement it.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// node is embedded in every AST node and records its extent
+type node struct {
+	pos Pos
+	end Pos
+}
+
+func (n *node) Pos() Pos { return n.pos }
+
+func (n *node) End() Pos { return n.end }
+
+func (n *node) setPos(pos Pos) { n.pos = pos }
+
+func (n *node) setEnd(pos Pos) { n.end = pos }
+
+// tokenPositions maps the start and the end of every token span to
+// positions in input
+func tokenPositions(input string, spans []lexer.Span) (starts, ends []Pos) {
+	starts = make([]Pos, len(spans))
+	ends = make([]Pos, len(spans))
+	line, lineStart, off := 1, 0, 0
+	at := func(target int) Pos {
+		for ; off < target; off++ {
+			if input[off] == '\n' {
+				line++
+				lineStart = off + 1
+			}
+		}
+		return Pos{Offset: target, Line: line, Column: target - lineStart + 1}
+	}
+	for i, span := range spans {
+		starts[i] = at(span.Start)
+		ends[i] = at(span.End)
+	}
+	return starts, ends
+}
+
+func (*SelectStmt) statementNode()                  {}
+func (*InsertStmt) statementNode()                  {}
+func (*UpdateStmt) statementNode()                  {}
+func (*DeleteStmt) statementNode()                  {}
+func (*CreateTableStmt) statementNode()             {}
+func (*CreateIndexStmt) statementNode()             {}
+func (*DropIndexStmt) statementNode()               {}
+func (*CreateViewStmt) statementNode()              {}
+func (*RefreshMaterializedViewStmt) statementNode() {}
+func (*BeginStmt) statementNode()                   {}
+func (*CommitStmt) statementNode()                  {}
+func (*RollbackStmt) statementNode()                {}
+func (*SavepointStmt) statementNode()               {}
+func (*ReleaseSavepointStmt) statementNode()        {}
+func (*PrepareStmt) statementNode()                 {}
+func (*ExecuteStmt) statementNode()                 {}
+func (*DeallocateStmt) statementNode()              {}
+func (*ExplainStmt) statementNode()                 {}
+func (*AlterTableStmt) statementNode()              {}
+
+func (*ColumnRef) exprNode()     {}
+func (*LiteralInt) exprNode()    {}
+func (*LiteralString) exprNode() {}
+func (*LiteralNull) exprNode()   {}
+func (*BinaryOp) exprNode()      {}
+func (*LogicalOp) exprNode()     {}
+func (*ComparisonOp) exprNode()  {}
+func (*SubqueryExpr) exprNode()  {}
+func (*ExistsExpr) exprNode()    {}
+func (*InExpr) exprNode()        {}
+func (*BetweenExpr) exprNode()   {}
+func (*LikeExpr) exprNode()      {}
+func (*CaseExpr) exprNode()      {}
+func (*FuncCall) exprNode()      {}
+func (*Param) exprNode()         {}
+func (*CastExpr) exprNode()      {}
+
+// Statements render as their PrintAST block without a trailing newline.
+
+func (s *SelectStmt) String() string      { return block(formatSelect(s, "")) }
+func (s *InsertStmt) String() string      { return block(formatInsert(s, "")) }
+func (s *UpdateStmt) String() string      { return block(formatUpdate(s, "")) }
+func (s *DeleteStmt) String() string      { return block(formatDelete(s, "")) }
+func (s *CreateTableStmt) String() string { return block(formatCreateTable(s, "")) }
+func (s *CreateIndexStmt) String() string { return block(formatCreateIndex(s, "")) }
+func (s *CreateViewStmt) String() string  { return block(formatCreateView(s, "")) }
+func (s *AlterTableStmt) String() string  { return block(formatAlterTable(s, "")) }
+func (s *PrepareStmt) String() string     { return block(formatPrepare(s, "")) }
+func (s *ExplainStmt) String() string     { return block(formatExplain(s, "")) }
+
+func (s *DropIndexStmt) String() string {
+	if s.IfExists {
+		return "DROP INDEX IF EXISTS " + s.Name
+	}
+	return "DROP INDEX " + s.Name
+}
+
+func (s *RefreshMaterializedViewStmt) String() string {
+	return "REFRESH MATERIALIZED VIEW " + s.Name
+}
+
+func (s *BeginStmt) String() string {
+	if s.IsolationLevel != "" {
+		return "BEGIN ISOLATION LEVEL " + s.IsolationLevel
+	}
+	return "BEGIN"
+}
+
+func (s *CommitStmt) String() string { return "COMMIT" }
+
+func (s *RollbackStmt) String() string {
+	if s.Savepoint != "" {
+		return "ROLLBACK TO SAVEPOINT " + s.Savepoint
+	}
+	return "ROLLBACK"
+}
+
+func (s *SavepointStmt) String() string        { return "SAVEPOINT " + s.Name }
+func (s *ReleaseSavepointStmt) String() string { return "RELEASE SAVEPOINT " + s.Name }
+
+func (s *ExecuteStmt) String() string {
+	if len(s.Args) == 0 {
+		return "EXECUTE " + s.Name
+	}
+	return "EXECUTE " + s.Name + " (" + joinExprs(s.Args) + ")"
+}
+
+func (s *DeallocateStmt) String() string {
+	if s.All {
+		return "DEALLOCATE ALL"
+	}
+	return "DEALLOCATE " + s.Name
+}
+
+// Expressions render in the inline form PrintAST uses for projections and values.
+
+func (e *ColumnRef) String() string     { return "col:" + e.Name }
+func (e *LiteralInt) String() string    { return fmt.Sprintf("int:%d", e.Value) }
+func (e *LiteralString) String() string { return "str:'" + e.Value + "'" }
+func (e *LiteralNull) String() string   { return "NULL" }
+func (e *Param) String() string         { return "param:" + formatParam(e) }
+func (e *SubqueryExpr) String() string  { return "(subquery)" }
+
+func (e *ComparisonOp) String() string {
+	return e.Left.String() + " " + e.Op + " " + e.Right.String()
+}
+
+func (e *LogicalOp) String() string {
+	return "(" + e.Left.String() + " " + e.Op + " " + e.Right.String() + ")"
+}
+
+func (e *BinaryOp) String() string {
+	return "(" + e.Left.String() + " " + e.Op + " " + e.Right.String() + ")"
+}
+
+func (e *ExistsExpr) String() string {
+	if e.Not {
+		return "NOT EXISTS (subquery)"
+	}
+	return "EXISTS (subquery)"
+}
+
+func (e *InExpr) String() string {
+	op := " IN "
+	if e.Not {
+		op = " NOT IN "
+	}
+	if e.Subquery != nil {
+		return e.Left.String() + op + "(subquery)"
+	}
+	return e.Left.String() + op + "(" + joinExprs(e.List) + ")"
+}
+
+func (e *BetweenExpr) String() string {
+	op := " BETWEEN "
+	if e.Not {
+		op = " NOT BETWEEN "
+	}
+	return e.Expr.String() + op + e.Low.String() + " AND " + e.High.String()
+}
+
+func (e *LikeExpr) String() string {
+	op := " " + e.Op + " "
+	if e.Not {
+		op = " NOT " + e.Op + " "
+	}
+	out := e.Left.String() + op + e.Pattern.String()
+	if e.Escape != nil {
+		out += " ESCAPE " + e.Escape.String()
+	}
+	return out
+}
+
+func (e *CaseExpr) String() string {
+	out := "CASE"
+	if e.Operand != nil {
+		out += " " + e.Operand.String()
+	}
+	for _, w := range e.Whens {
+		out += " WHEN " + w.Cond.String() + " THEN " + w.Result.String()
+	}
+	if e.Else != nil {
+		out += " ELSE " + e.Else.String()
+	}
+	return out + " END"
+}
+
+func (e *CastExpr) String() string {
+	return "CAST(" + e.Expr.String() + " AS " + e.Type.String() + ")"
+}
+
+func (e *FuncCall) String() string {
+	args := joinExprs(e.Args)
+	if e.Star {
+		args = "*"
+	}
+	out := e.Name + "(" + args + ")"
+	if e.Over != nil {
+		if e.Over.Name != "" && len(e.Over.PartitionBy) == 0 && len(e.Over.OrderBy) == 0 && e.Over.Frame == nil {
+			return out + " OVER " + e.Over.Name
+		}
+		out += " OVER (" + formatWindowSpec(e.Over) + ")"
+	}
+	return out
+}
+
+func joinExprs(exprs []Expr) string {
+	items := make([]string, len(exprs))
+	for i, e := range exprs {
+		items[i] = e.String()
+	}
+	return strings.Join(items, ", ")
+}
+
+func block(s string) string {
+	return strings.TrimSuffix(s, "\n")
+}
@@ -8,87 +8,474 @@ import (
 	"github.com/vvshulga/db_internals/lexer"
 )
 
-// AstNode represents a top-level statement
-type AstNode interface{}
+// AstNode represents a top-level statement.
+//
+// Deprecated: use Statement.
+type AstNode = Statement
 
-// SelectStmt: SELECT projections FROM table [WHERE selection] [LIMIT limit]
+// SelectStmt: [WITH ...] SELECT projections FROM table [WHERE selection] [ORDER BY ...] [LIMIT limit]
+// When SetOp is set the statement is a compound query; Projections, From and
+// Selection are empty and OrderBy/Limit apply to the whole compound.
 type SelectStmt struct {
+	node
+	With        *WithClause      // common table expressions (optional)
 	Projections []ProjectionItem // columns list or *
 	From        TableRef         // 1 table
 	Selection   Expr             // WHERE clause (optional)
+	Windows     []NamedWindow    // WINDOW clause (optional)
+	SetOp       *SetOperation    // UNION/INTERSECT/EXCEPT (optional)
+	OrderBy     []OrderByItem    // ORDER BY (optional)
 	Limit       *uint64          // LIMIT (optional)
 }
 
+// SetOperation: left UNION [ALL] | INTERSECT | EXCEPT right
+type SetOperation struct {
+	Op    string // UNION, INTERSECT, EXCEPT
+	All   bool
+	Left  *SelectStmt
+	Right *SelectStmt
+}
+
+// WithClause: WITH [RECURSIVE] name [(col, ...)] AS (query), ...
+type WithClause struct {
+	Recursive bool
+	CTEs      []CommonTableExpr
+}
+
+type CommonTableExpr struct {
+	Name    string
+	Columns []string // optional column list
+	Query   *SelectStmt
+}
+
+type OrderByItem struct {
+	Expr Expr
+	Desc bool
+}
+
+// NamedWindow: WINDOW name AS (spec)
+type NamedWindow struct {
+	Name string
+	Spec WindowSpec
+}
+
+// WindowSpec: ([base_window] [PARTITION BY ...] [ORDER BY ...] [frame])
+// A bare OVER name reference sets only Name.
+type WindowSpec struct {
+	Name        string // referenced window (optional)
+	PartitionBy []Expr
+	OrderBy     []OrderByItem
+	Frame       *WindowFrame // optional
+}
+
+// WindowFrame: ROWS|RANGE start or ROWS|RANGE BETWEEN start AND end
+type WindowFrame struct {
+	Unit  string // ROWS, RANGE
+	Start FrameBound
+	End   *FrameBound // set for BETWEEN frames
+}
+
+// FrameBound is one end of a window frame. Offset is set for the
+// "n PRECEDING" and "n FOLLOWING" kinds.
+type FrameBound struct {
+	Kind   string // UNBOUNDED PRECEDING, PRECEDING, CURRENT ROW, FOLLOWING, UNBOUNDED FOLLOWING
+	Offset Expr
+}
+
 type ProjectionItem struct {
 	All    bool
 	Column string
+	Expr   Expr   // computed projection such as a scalar subquery; nil for plain columns
+	Alias  string // AS alias (optional)
 }
 
+// TableRef is either a named table or a derived table: FROM (SELECT ...) AS alias
 type TableRef struct {
-	Name string
+	Name     string
+	Subquery *SelectStmt
+	Alias    string
 }
 
-// InsertStmt: INSERT INTO table VALUES (expr, ...)
+// InsertStmt: [WITH ...] INSERT INTO table [(col, ...)] VALUES (expr, ...)
 type InsertStmt struct {
+	node
+	With       *WithClause // common table expressions (optional)
+	TableName  string
+	Columns    []string         // target column list (optional)
+	Values     []Expr           // single row of expressions
+	OnConflict *OnConflict      // ON CONFLICT clause (optional)
+	Returning  []ProjectionItem // RETURNING list (optional)
+}
+
+// UpdateStmt: UPDATE table SET col = value, ... [WHERE selection] [RETURNING ...]
+type UpdateStmt struct {
+	node
+	With      *WithClause // common table expressions (optional)
 	TableName string
-	Values    []Expr // single row of expressions
+	Set       []Assignment
+	Selection Expr             // WHERE condition (optional)
+	Returning []ProjectionItem // RETURNING list (optional)
+}
+
+// DeleteStmt: DELETE FROM table [WHERE selection] [RETURNING ...]
+type DeleteStmt struct {
+	node
+	With      *WithClause // common table expressions (optional)
+	TableName string
+	Selection Expr             // WHERE condition (optional)
+	Returning []ProjectionItem // RETURNING list (optional)
+}
+
+// OnConflict: ON CONFLICT [(col, ...) | ON CONSTRAINT name] DO NOTHING
+// or DO UPDATE SET col = value, ... [WHERE condition]. The proposed row is
+// visible to DO UPDATE as EXCLUDED (e.g. EXCLUDED.col).
+type OnConflict struct {
+	Columns    []string     // conflict target columns (optional)
+	Constraint string       // conflict target constraint name (optional)
+	DoNothing  bool         // DO NOTHING; otherwise DO UPDATE
+	Set        []Assignment // DO UPDATE SET assignments
+	Where      Expr         // DO UPDATE ... WHERE condition (optional)
+}
+
+// Assignment: col = value
+type Assignment struct {
+	Column string
+	Value  Expr
 }
 
-// CreateTableStmt: CREATE TABLE table (col1 type1, col2 type2, ...)
+// CreateTableStmt: CREATE TABLE [IF NOT EXISTS] table (col1 type1, col2 type2, ..., [table constraints])
+// or CREATE TABLE [IF NOT EXISTS] table AS SELECT ..., in which case AsSelect
+// is set and Columns is empty.
 type CreateTableStmt struct {
+	node
+	TableName   string
+	IfNotExists bool
+	Columns     []ColumnDef
+	Constraints []TableConstraint
+	AsSelect    *SelectStmt
+}
+
+// TableConstraint: [CONSTRAINT name] PRIMARY KEY (cols) | UNIQUE (cols) |
+// FOREIGN KEY (cols) REFERENCES ... | CHECK (expr)
+type TableConstraint struct {
+	Name       string // optional
+	Type       string // PRIMARY KEY, UNIQUE, FOREIGN KEY, CHECK
+	Columns    []string
+	Check      Expr        // set for CHECK
+	References *References // set for FOREIGN KEY
+}
+
+// CreateIndexStmt: CREATE [UNIQUE] INDEX [IF NOT EXISTS] name ON table (col [ASC|DESC], ...) [WHERE predicate]
+type CreateIndexStmt struct {
+	node
+	Name        string
+	Unique      bool
+	IfNotExists bool
+	TableName   string
+	Columns     []IndexColumn
+	Where       Expr // partial index predicate (optional)
+}
+
+type IndexColumn struct {
+	Name string
+	Desc bool
+}
+
+// DropIndexStmt: DROP INDEX [IF EXISTS] name
+type DropIndexStmt struct {
+	node
+	Name     string
+	IfExists bool
+}
+
+// CreateViewStmt: CREATE [OR REPLACE] [MATERIALIZED] VIEW name [(col, ...)] AS SELECT ...
+type CreateViewStmt struct {
+	node
+	Name         string
+	OrReplace    bool
+	Materialized bool
+	Columns      []string // optional column list
+	Query        *SelectStmt
+}
+
+// RefreshMaterializedViewStmt: REFRESH MATERIALIZED VIEW name
+type RefreshMaterializedViewStmt struct {
+	node
+	Name string
+}
+
+// BeginStmt: BEGIN [TRANSACTION] or START TRANSACTION, with an optional ISOLATION LEVEL
+type BeginStmt struct {
+	node
+	IsolationLevel string // SERIALIZABLE, REPEATABLE READ, READ COMMITTED, READ UNCOMMITTED (optional)
+}
+
+// CommitStmt: COMMIT [TRANSACTION]
+type CommitStmt struct {
+	node
+}
+
+// RollbackStmt: ROLLBACK [TRANSACTION] [TO [SAVEPOINT] name]
+type RollbackStmt struct {
+	node
+	Savepoint string // set for ROLLBACK TO SAVEPOINT
+}
+
+// SavepointStmt: SAVEPOINT name
+type SavepointStmt struct {
+	node
+	Name string
+}
+
+// ReleaseSavepointStmt: RELEASE [SAVEPOINT] name
+type ReleaseSavepointStmt struct {
+	node
+	Name string
+}
+
+// PrepareStmt: PREPARE name [(type, ...)] AS statement
+type PrepareStmt struct {
+	node
+	Name       string
+	ParamTypes []DataType // optional
+	Statement  Statement
+}
+
+// ExecuteStmt: EXECUTE name [(arg, ...)]
+type ExecuteStmt struct {
+	node
+	Name string
+	Args []Expr
+}
+
+// DeallocateStmt: DEALLOCATE [PREPARE] name | ALL
+type DeallocateStmt struct {
+	node
+	Name string
+	All  bool
+}
+
+// ExplainStmt: EXPLAIN [ANALYZE] [VERBOSE] statement
+// or EXPLAIN (option [, ...]) statement with options ANALYZE, VERBOSE and FORMAT TEXT|JSON
+type ExplainStmt struct {
+	node
+	Analyze   bool
+	Verbose   bool
+	Format    string // TEXT or JSON; empty when not specified
+	Statement Statement
+}
+
+// AlterTableStmt: ALTER TABLE table action {, action}
+type AlterTableStmt struct {
+	node
 	TableName string
-	Columns   []ColumnDef
+	Actions   []AlterTableAction
+}
+
+// AlterTableAction is a single ALTER TABLE change. Type selects which of the
+// remaining fields are set:
+//
+//	ADD COLUMN        Column
+//	DROP COLUMN       ColumnName, IfExists
+//	RENAME COLUMN     ColumnName, NewName
+//	RENAME TO         NewName
+//	ALTER COLUMN TYPE ColumnName, DataType
+//	SET DEFAULT       ColumnName, Default
+//	DROP DEFAULT      ColumnName
+//	SET NOT NULL      ColumnName
+//	DROP NOT NULL     ColumnName
+//	ADD CONSTRAINT    Constraint
+//	DROP CONSTRAINT   ConstraintName, IfExists
+type AlterTableAction struct {
+	Type           string
+	Column         *ColumnDef
+	ColumnName     string
+	NewName        string
+	DataType       DataType
+	Default        Expr
+	Constraint     *TableConstraint
+	ConstraintName string
+	IfExists       bool
 }
 
+// ColumnDef: name type [constraints]
 type ColumnDef struct {
-	Name string
-	Type string
+	Name       string
+	Type       DataType
+	PrimaryKey bool
+	NotNull    bool
+	Null       bool // explicit NULL
+	Unique     bool
+	Default    Expr        // DEFAULT expr (optional)
+	Check      Expr        // CHECK (expr) (optional)
+	References *References // REFERENCES table [(col, ...)] (optional)
 }
 
-// Expr represents expressions in WHERE clauses and VALUES
-type Expr interface{}
+// References is the target of a foreign key
+type References struct {
+	Table    string
+	Columns  []string // optional column list
+	OnDelete string   // CASCADE, RESTRICT, NO ACTION, SET NULL, SET DEFAULT (optional)
+	OnUpdate string   // same actions as OnDelete (optional)
+}
 
 type ColumnRef struct {
+	node
 	Name string
 }
 
 type LiteralInt struct {
+	node
 	Value uint64
 }
 
 type LiteralString struct {
+	node
 	Value string
 }
 
+type LiteralNull struct {
+	node
+}
+
 type BinaryOp struct {
+	node
 	Left  Expr
 	Op    string
 	Right Expr
 }
 
 type LogicalOp struct {
+	node
 	Left  Expr
 	Op    string // AND, OR
 	Right Expr
 }
 
 type ComparisonOp struct {
+	node
 	Left  Expr
 	Op    string
 	Right Expr
 }
 
+// SubqueryExpr is a parenthesized SELECT used as a scalar value
+type SubqueryExpr struct {
+	node
+	Select *SelectStmt
+}
+
+// ExistsExpr: [NOT] EXISTS (SELECT ...)
+type ExistsExpr struct {
+	node
+	Not      bool
+	Subquery *SelectStmt
+}
+
+// InExpr: expr [NOT] IN (SELECT ...) or expr [NOT] IN (value, ...)
+type InExpr struct {
+	node
+	Left     Expr
+	Not      bool
+	Subquery *SelectStmt // set for IN (SELECT ...)
+	List     []Expr      // set for IN (value, ...)
+}
+
+// BetweenExpr: expr [NOT] BETWEEN low AND high
+type BetweenExpr struct {
+	node
+	Expr Expr
+	Not  bool
+	Low  Expr
+	High Expr
+}
+
+// LikeExpr: expr [NOT] LIKE|ILIKE pattern [ESCAPE escape]
+type LikeExpr struct {
+	node
+	Left    Expr
+	Not     bool
+	Op      string // LIKE, ILIKE
+	Pattern Expr
+	Escape  Expr // optional
+}
+
+// CaseExpr: CASE [operand] WHEN ... THEN ... [ELSE ...] END
+// Operand is nil for a searched CASE, where each When holds a condition.
+type CaseExpr struct {
+	node
+	Operand Expr
+	Whens   []WhenClause
+	Else    Expr // optional
+}
+
+type WhenClause struct {
+	Cond   Expr
+	Result Expr
+}
+
+// FuncCall: name([args | *]) [OVER window]
+type FuncCall struct {
+	node
+	Name string
+	Args []Expr
+	Star bool        // name(*)
+	Over *WindowSpec // window function (optional)
+}
+
+// ParamStyle is the syntax a bind parameter was written in
+type ParamStyle string
+
+const (
+	ParamDollar   ParamStyle = "$"
+	ParamQuestion ParamStyle = "?"
+	ParamNamed    ParamStyle = ":"
+)
+
+// Param is a bind parameter: positional ($1, ?) or named (:name).
+// ? parameters are numbered in order of appearance within their statement.
+type Param struct {
+	node
+	Style    ParamStyle
+	Position int    // 1-based position for $n and ?
+	Name     string // set for :name
+}
+
+// CastExpr: CAST(expr AS type) or expr::type
+type CastExpr struct {
+	node
+	Expr Expr
+	Type DataType
+}
+
 // ParseString tokenizes and parses input into AST nodes
-func ParseString(input string) ([]AstNode, error) {
-	toks := lexer.Tokenize(input)
-	p := &parser{tokens: toks}
+func ParseString(input string) ([]Statement, error) {
+	toks, spans := lexer.TokenizeSpans(input)
+	starts, ends := tokenPositions(input, spans)
+	p := &parser{tokens: toks, positions: starts, ends: ends}
 	return p.parseStatements()
 }
 
+// Params returns every bind parameter in node, in the order they appear in the AST.
+// A parameter used several times is reported once per use.
+func Params(node Node) []*Param {
+	var out []*Param
+	Inspect(node, func(n Node) bool {
+		if param, ok := n.(*Param); ok {
+			out = append(out, param)
+		}
+		return true
+	})
+	return out
+}
+
 // internal parser
 type parser struct {
-	tokens []lexer.Token
-	pos    int
+	tokens    []lexer.Token
+	positions []Pos // position of each token
+	ends      []Pos // position just past each token
+	pos       int
+	params    int // number of ? parameters seen in the current statement
 }
 
 func (p *parser) peek() *lexer.Token {
@@ -98,6 +485,42 @@ func (p *parser) peek() *lexer.Token {
 	return &p.tokens[p.pos]
 }
 
+// peekPos returns the position of the next token, or the zero Pos at eof
+func (p *parser) peekPos() Pos {
+	if p.pos >= len(p.positions) {
+		return Pos{}
+	}
+	return p.positions[p.pos]
+}
+
+// lastEnd returns the position just past the last consumed token
+func (p *parser) lastEnd() Pos {
+	if p.pos == 0 || p.pos > len(p.ends) {
+		return Pos{}
+	}
+	return p.ends[p.pos-1]
+}
+
+// span returns the position record for a node that starts at start and
+// ends with the last consumed token
+func (p *parser) span(start Pos) node {
+	return node{pos: start, end: p.lastEnd()}
+}
+
+// setSpan records that n starts at start and ends with the last consumed token
+func (p *parser) setSpan(n Node, start Pos) {
+	n.setPos(start)
+	n.setEnd(p.lastEnd())
+}
+
+// peekAhead returns the token n positions after the next one, or nil past eof
+func (p *parser) peekAhead(n int) *lexer.Token {
+	if p.pos+n >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos+n]
+}
+
 func (p *parser) next() *lexer.Token {
 	if p.pos >= len(p.tokens) {
 		return nil
@@ -119,6 +542,34 @@ func (p *parser) consumeKeyword(name string) bool {
 	return false
 }
 
+// peekKeyword reports whether the next token is the given keyword
+func (p *parser) peekKeyword(name string) bool {
+	t := p.peek()
+	return t != nil && t.Type == lexer.TokenKeyword && strings.EqualFold(t.Value, name)
+}
+
+// peekSeparator reports whether the next token is the given separator
+func (p *parser) peekSeparator(value string) bool {
+	t := p.peek()
+	return t != nil && t.Type == lexer.TokenSeparator && t.Value == value
+}
+
+// consumeWord consumes a keyword or identifier matching name. It is used for
+// context-dependent words that are not reserved by the lexer.
+func (p *parser) consumeWord(name string) bool {
+	if !p.peekWord(name) {
+		return false
+	}
+	p.next()
+	return true
+}
+
+// peekWord reports whether the next token is a keyword or identifier matching name
+func (p *parser) peekWord(name string) bool {
+	t := p.peek()
+	return t != nil && (t.Type == lexer.TokenKeyword || t.Type == lexer.TokenIdentifier) && strings.EqualFold(t.Value, name)
+}
+
 func (p *parser) expectKeyword(name string) error {
 	if p.consumeKeyword(name) {
 		return nil
@@ -130,14 +581,15 @@ func (p *parser) expectKeyword(name string) error {
 	return fmt.Errorf("expected keyword %s, got %s", name, t.Value)
 }
 
-func (p *parser) parseStatements() ([]AstNode, error) {
-	var out []AstNode
+func (p *parser) parseStatements() ([]Statement, error) {
+	var out []Statement
 	for p.peek() != nil {
 		// skip stray semicolons
 		if p.peek().Type == lexer.TokenSeparator && p.peek().Value == ";" {
 			p.next()
 			continue
 		}
+		p.params = 0
 		node, err := p.parseStatement()
 		if err != nil {
 			return nil, err
@@ -151,7 +603,19 @@ func (p *parser) parseStatements() ([]AstNode, error) {
 	return out, nil
 }
 
-func (p *parser) parseStatement() (AstNode, error) {
+// parseStatement parses a single statement and records where it starts and ends
+func (p *parser) parseStatement() (Statement, error) {
+	start := p.peekPos()
+	stmt, err := p.parseStatementKind()
+	if err != nil {
+		return nil, err
+	}
+	p.setSpan(stmt, start)
+	return stmt, nil
+}
+
+// parseStatementKind dispatches on the token that starts a statement
+func (p *parser) parseStatementKind() (Statement, error) {
 	t := p.peek()
 	if t == nil {
 		return nil, fmt.Errorf("unexpected eof")
@@ -159,64 +623,209 @@ func (p *parser) parseStatement() (AstNode, error) {
 	if t.Type == lexer.TokenKeyword {
 		switch strings.ToUpper(t.Value) {
 		case "SELECT":
-			return p.parseSelect()
+			sel, err := p.parseSelect()
+			if err != nil {
+				return nil, err
+			}
+			return sel, nil
 		case "INSERT":
-			return p.parseInsert()
+			ins, err := p.parseInsert()
+			if err != nil {
+				return nil, err
+			}
+			return ins, nil
+		case "UPDATE":
+			upd, err := p.parseUpdate()
+			if err != nil {
+				return nil, err
+			}
+			return upd, nil
+		case "DELETE":
+			del, err := p.parseDelete()
+			if err != nil {
+				return nil, err
+			}
+			return del, nil
+		case "WITH":
+			return p.parseWithStatement()
 		case "CREATE":
-			return p.parseCreateTable()
+			return p.parseCreate()
+		case "DROP":
+			return p.parseDrop()
+		case "ALTER":
+			return p.parseAlterTable()
+		case "REFRESH":
+			return p.parseRefresh()
+		case "BEGIN", "COMMIT", "ROLLBACK", "SAVEPOINT":
+			return p.parseTransactionControl()
+		case "PREPARE":
+			return p.parsePrepare()
+		case "EXECUTE":
+			return p.parseExecute()
+		case "DEALLOCATE":
+			return p.parseDeallocate()
+		case "EXPLAIN":
+			return p.parseExplain()
+		}
+	}
+	// START and RELEASE are not reserved words
+	if p.peekWord("START") || p.peekWord("RELEASE") {
+		return p.parseTransactionControl()
+	}
+	if p.peekSeparator("(") {
+		sel, err := p.parseSelect()
+		if err != nil {
+			return nil, err
 		}
+		return sel, nil
 	}
 	return nil, fmt.Errorf("unsupported statement starting with %v", t.Value)
 }
 
-func (p *parser) parseSelect() (AstNode, error) {
-	// consume SELECT
-	p.next()
-	proj := []ProjectionItem{}
-	// projection list
-	if p.peek() == nil {
-		return nil, fmt.Errorf("unexpected eof after SELECT")
+// parseWithStatement parses a WITH clause and the SELECT, INSERT, UPDATE or
+// DELETE it applies to
+func (p *parser) parseWithStatement() (Statement, error) {
+	with, err := p.parseWith()
+	if err != nil {
+		return nil, err
 	}
-	if p.peek().Type == lexer.TokenSeparator && p.peek().Value == "*" {
-		p.next()
-		proj = append(proj, ProjectionItem{All: true})
-	} else {
-		for {
-			t := p.peek()
-			if t == nil || t.Type != lexer.TokenIdentifier {
-				return nil, fmt.Errorf("expected projection identifier, got %v", t)
+	switch {
+	case p.peekKeyword("INSERT"):
+		ins, err := p.parseInsert()
+		if err != nil {
+			return nil, err
+		}
+		ins.With = with
+		return ins, nil
+	case p.peekKeyword("UPDATE"):
+		upd, err := p.parseUpdate()
+		if err != nil {
+			return nil, err
+		}
+		upd.With = with
+		return upd, nil
+	case p.peekKeyword("DELETE"):
+		del, err := p.parseDelete()
+		if err != nil {
+			return nil, err
+		}
+		del.With = with
+		return del, nil
+	}
+	if !p.peekKeyword("SELECT") && !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected SELECT, INSERT, UPDATE or DELETE after WITH clause, got %v", p.peek())
+	}
+	sel, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	// a parenthesized body may carry its own WITH, which would be lost
+	if sel.With != nil {
+		return nil, fmt.Errorf("query after WITH clause already has a WITH clause")
+	}
+	sel.With = with
+	return sel, nil
+}
+
+// parseWith parses WITH [RECURSIVE] <cte> {, <cte>}
+func (p *parser) parseWith() (*WithClause, error) {
+	if err := p.expectKeyword("WITH"); err != nil {
+		return nil, err
+	}
+	with := &WithClause{Recursive: p.consumeKeyword("RECURSIVE")}
+	for {
+		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+			return nil, fmt.Errorf("expected common table expression name, got %v", p.peek())
+		}
+		cte := CommonTableExpr{Name: p.next().Value}
+		if p.peekSeparator("(") {
+			cols, err := p.parseIdentList()
+			if err != nil {
+				return nil, err
 			}
-			proj = append(proj, ProjectionItem{All: false, Column: t.Value})
+			cte.Columns = cols
+		}
+		if err := p.expectKeyword("AS"); err != nil {
+			return nil, err
+		}
+		query, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		cte.Query = query
+		with.CTEs = append(with.CTEs, cte)
+		if p.peekSeparator(",") {
 			p.next()
-			if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "," {
-				p.next()
-				continue
-			}
-			break
+			continue
 		}
+		return with, nil
 	}
-	// FROM
-	if err := p.expectKeyword("FROM"); err != nil {
+}
+
+// parseIdentList parses ( <identifier> {, <identifier>} )
+func (p *parser) parseIdentList() ([]string, error) {
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(' to start identifier list, got %v", p.peek())
+	}
+	p.next()
+	names := []string{}
+	for {
+		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+			return nil, fmt.Errorf("expected identifier, got %v", p.peek())
+		}
+		names = append(names, p.next().Value)
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		break
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after identifier list, got %v", p.peek())
+	}
+	p.next()
+	return names, nil
+}
+
+// parseSelect parses a full query: an optional WITH clause, one or more
+// SELECTs combined with set operations, and an optional ORDER BY and LIMIT
+func (p *parser) parseSelect() (*SelectStmt, error) {
+	start := p.peekPos()
+	var with *WithClause
+	if p.peekKeyword("WITH") {
+		w, err := p.parseWith()
+		if err != nil {
+			return nil, err
+		}
+		with = w
+	}
+	sel, err := p.parseUnion()
+	if err != nil {
 		return nil, err
 	}
-	// table
-	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
-		return nil, fmt.Errorf("expected table identifier after FROM")
+	if with != nil {
+		if sel.With != nil {
+			return nil, fmt.Errorf("multiple WITH clauses not allowed")
+		}
+		sel.With = with
 	}
-	table := p.next().Value
-	var selection Expr
-	// optional WHERE
-	if p.peek() != nil && p.peek().Type == lexer.TokenKeyword && strings.EqualFold(p.peek().Value, "WHERE") {
+	// optional ORDER BY
+	if p.peekKeyword("ORDER") {
 		p.next()
-		expr, err := p.parseLogical()
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if sel.OrderBy != nil {
+			return nil, fmt.Errorf("multiple ORDER BY clauses not allowed")
+		}
+		items, err := p.parseOrderByList()
 		if err != nil {
 			return nil, err
 		}
-		selection = expr
+		sel.OrderBy = items
 	}
 	// optional LIMIT
-	var limit *uint64
-	if p.peek() != nil && p.peek().Type == lexer.TokenKeyword && strings.EqualFold(p.peek().Value, "LIMIT") {
+	if p.peekKeyword("LIMIT") {
 		p.next()
 		if p.peek() == nil || p.peek().Type != lexer.TokenNumber {
 			return nil, fmt.Errorf("expected number after LIMIT")
@@ -226,50 +835,459 @@ func (p *parser) parseSelect() (AstNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		limit = &u
+		if sel.Limit != nil {
+			return nil, fmt.Errorf("multiple LIMIT clauses not allowed")
+		}
+		sel.Limit = &u
 	}
-	return &SelectStmt{Projections: proj, From: TableRef{Name: table}, Selection: selection, Limit: limit}, nil
+	p.setSpan(sel, start)
+	return sel, nil
 }
 
-// parseLogical handles expressions joined by AND/OR
-func (p *parser) parseLogical() (Expr, error) {
-	left, err := p.parseComparison()
+// parseUnion handles UNION and EXCEPT, which bind looser than INTERSECT
+func (p *parser) parseUnion() (*SelectStmt, error) {
+	start := p.peekPos()
+	left, err := p.parseIntersect()
 	if err != nil {
 		return nil, err
 	}
-	for p.peek() != nil && p.peek().Type == lexer.TokenKeyword && (strings.EqualFold(p.peek().Value, "AND") || strings.EqualFold(p.peek().Value, "OR")) {
+	for p.peekKeyword("UNION") || p.peekKeyword("EXCEPT") {
 		op := strings.ToUpper(p.next().Value)
-		right, err := p.parseComparison()
+		all := p.consumeKeyword("ALL")
+		right, err := p.parseIntersect()
 		if err != nil {
 			return nil, err
 		}
-		left = &LogicalOp{Left: left, Op: op, Right: right}
+		left = &SelectStmt{node: p.span(start), SetOp: &SetOperation{Op: op, All: all, Left: left, Right: right}}
 	}
 	return left, nil
 }
 
-// parseComparison expects <identifier> <op> <literal|identifier>
-func (p *parser) parseComparison() (Expr, error) {
-	// left operand
-	if p.peek() == nil {
-		return nil, fmt.Errorf("unexpected eof in expression")
+// parseIntersect handles INTERSECT
+func (p *parser) parseIntersect() (*SelectStmt, error) {
+	start := p.peekPos()
+	left, err := p.parseSelectTerm()
+	if err != nil {
+		return nil, err
 	}
-	var left Expr
-	if p.peek().Type == lexer.TokenIdentifier {
-		left = &ColumnRef{Name: p.next().Value}
-	} else {
-		return nil, fmt.Errorf("expected identifier on left side of comparison, got %v", p.peek())
+	for p.peekKeyword("INTERSECT") {
+		p.next()
+		all := p.consumeKeyword("ALL")
+		right, err := p.parseSelectTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &SelectStmt{node: p.span(start), SetOp: &SetOperation{Op: "INTERSECT", All: all, Left: left, Right: right}}
 	}
-	// operator
-	if p.peek() == nil || p.peek().Type != lexer.TokenOperator {
-		return nil, fmt.Errorf("expected comparison operator, got %v", p.peek())
+	return left, nil
+}
+
+// parseSelectTerm parses a single SELECT or a parenthesized query
+func (p *parser) parseSelectTerm() (*SelectStmt, error) {
+	if p.peekSeparator("(") {
+		p.next()
+		sel, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekSeparator(")") {
+			return nil, fmt.Errorf("expected ')' after query, got %v", p.peek())
+		}
+		p.next()
+		return sel, nil
+	}
+	if !p.peekKeyword("SELECT") {
+		return nil, fmt.Errorf("expected SELECT, got %v", p.peek())
+	}
+	return p.parseSelectCore()
+}
+
+// parseSelectCore parses SELECT projections FROM table [WHERE selection]
+func (p *parser) parseSelectCore() (*SelectStmt, error) {
+	start := p.peekPos()
+	// consume SELECT
+	p.next()
+	if p.peek() == nil {
+		return nil, fmt.Errorf("unexpected eof after SELECT")
+	}
+	proj, err := p.parseProjectionList()
+	if err != nil {
+		return nil, err
+	}
+	// FROM
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	from, err := p.parseTableRef()
+	if err != nil {
+		return nil, err
+	}
+	var selection Expr
+	// optional WHERE
+	if p.peekKeyword("WHERE") {
+		p.next()
+		expr, err := p.parseLogical()
+		if err != nil {
+			return nil, err
+		}
+		selection = expr
+	}
+	// optional WINDOW
+	var windows []NamedWindow
+	if p.consumeKeyword("WINDOW") {
+		for {
+			if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+				return nil, fmt.Errorf("expected window name, got %v", p.peek())
+			}
+			name := p.next().Value
+			if err := p.expectKeyword("AS"); err != nil {
+				return nil, err
+			}
+			spec, err := p.parseWindowSpec()
+			if err != nil {
+				return nil, err
+			}
+			windows = append(windows, NamedWindow{Name: name, Spec: *spec})
+			if p.peekSeparator(",") {
+				p.next()
+				continue
+			}
+			break
+		}
+	}
+	return &SelectStmt{node: p.span(start), Projections: proj, From: from, Selection: selection, Windows: windows}, nil
+}
+
+// parseProjectionList parses * or <projection> {, <projection>}
+func (p *parser) parseProjectionList() ([]ProjectionItem, error) {
+	if p.peekSeparator("*") {
+		p.next()
+		return []ProjectionItem{{All: true}}, nil
+	}
+	proj := []ProjectionItem{}
+	for {
+		item, err := p.parseProjection()
+		if err != nil {
+			return nil, err
+		}
+		proj = append(proj, item)
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		return proj, nil
+	}
+}
+
+// parseReturning parses an optional RETURNING projection list
+func (p *parser) parseReturning() ([]ProjectionItem, error) {
+	if !p.consumeWord("RETURNING") {
+		return nil, nil
+	}
+	if p.peek() == nil {
+		return nil, fmt.Errorf("unexpected eof after RETURNING")
+	}
+	return p.parseProjectionList()
+}
+
+// parseOrderByList parses <operand> [ASC|DESC] {, <operand> [ASC|DESC]}
+func (p *parser) parseOrderByList() ([]OrderByItem, error) {
+	items := []OrderByItem{}
+	for {
+		expr, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		item := OrderByItem{Expr: expr}
+		if p.consumeKeyword("DESC") {
+			item.Desc = true
+		} else {
+			p.consumeKeyword("ASC")
+		}
+		items = append(items, item)
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		return items, nil
+	}
+}
+
+// parseProjection parses a single select list item with an optional AS alias
+func (p *parser) parseProjection() (ProjectionItem, error) {
+	t := p.peek()
+	if t == nil {
+		return ProjectionItem{}, fmt.Errorf("unexpected eof in projection list")
+	}
+	var item ProjectionItem
+	if t.Type == lexer.TokenIdentifier && !p.peekCastAhead() && !p.peekCallAhead() {
+		item.Column = p.next().Value
+	} else if t.Type == lexer.TokenKeyword && !p.peekKeyword("CASE") && !p.peekKeyword("CAST") && !p.peekKeyword("NULL") {
+		return ProjectionItem{}, fmt.Errorf("expected projection identifier, got %v", t)
+	} else {
+		expr, err := p.parseOperand()
+		if err != nil {
+			return ProjectionItem{}, err
+		}
+		item.Expr = expr
+	}
+	if p.peekKeyword("AS") {
+		p.next()
+		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+			return ProjectionItem{}, fmt.Errorf("expected alias after AS")
+		}
+		item.Alias = p.next().Value
+	}
+	return item, nil
+}
+
+// peekCastAhead reports whether the token after the next one is a :: cast
+func (p *parser) peekCastAhead() bool {
+	t := p.peekAhead(1)
+	return t != nil && t.Type == lexer.TokenOperator && t.Value == "::"
+}
+
+// peekCallAhead reports whether the token after the next one opens a call's argument list
+func (p *parser) peekCallAhead() bool {
+	t := p.peekAhead(1)
+	return t != nil && t.Type == lexer.TokenSeparator && t.Value == "("
+}
+
+// parseTableRef parses a table name or a derived table, each with an optional alias
+func (p *parser) parseTableRef() (TableRef, error) {
+	var ref TableRef
+	if p.peekSeparator("(") {
+		sub, err := p.parseSubquery()
+		if err != nil {
+			return TableRef{}, err
+		}
+		ref.Subquery = sub
+	} else {
+		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+			return TableRef{}, fmt.Errorf("expected table identifier after FROM")
+		}
+		ref.Name = p.next().Value
+	}
+	// optional alias, with or without AS
+	if p.peekKeyword("AS") {
+		p.next()
+		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+			return TableRef{}, fmt.Errorf("expected alias after AS")
+		}
+		ref.Alias = p.next().Value
+	} else if p.peek() != nil && p.peek().Type == lexer.TokenIdentifier {
+		ref.Alias = p.next().Value
+	}
+	if ref.Subquery != nil && ref.Alias == "" {
+		return TableRef{}, fmt.Errorf("subquery in FROM must have an alias")
+	}
+	return ref, nil
+}
+
+// parseSubquery expects ( SELECT ... )
+func (p *parser) parseSubquery() (*SelectStmt, error) {
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(' to start subquery, got %v", p.peek())
+	}
+	p.next()
+	if !p.peekKeyword("SELECT") && !p.peekKeyword("WITH") {
+		return nil, fmt.Errorf("expected SELECT in subquery, got %v", p.peek())
+	}
+	sel, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after subquery, got %v", p.peek())
+	}
+	p.next()
+	return sel, nil
+}
+
+// parseLogical handles expressions joined by AND/OR
+func (p *parser) parseLogical() (Expr, error) {
+	start := p.peekPos()
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("AND") || p.peekKeyword("OR") {
+		op := strings.ToUpper(p.next().Value)
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &LogicalOp{node: p.span(start), Left: left, Op: op, Right: right}
+	}
+	return left, nil
+}
+
+// parseComparison handles [NOT] EXISTS (subquery), the IN, BETWEEN and LIKE
+// predicates and <operand> <op> <operand>
+func (p *parser) parseComparison() (Expr, error) {
+	start := p.peekPos()
+	if p.peek() == nil {
+		return nil, fmt.Errorf("unexpected eof in expression")
+	}
+	if p.peekKeyword("NOT") || p.peekKeyword("EXISTS") {
+		not := false
+		if p.peekKeyword("NOT") {
+			p.next()
+			not = true
+		}
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		sub, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ExistsExpr{node: p.span(start), Not: not, Subquery: sub}, nil
+	}
+	// parenthesized condition
+	if p.peekSeparator("(") && !p.peekSubqueryAhead() {
+		return p.parseParenCondition()
+	}
+	// left operand
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	// [NOT] IN | BETWEEN | LIKE | ILIKE
+	not := false
+	if p.peekKeyword("NOT") {
+		p.next()
+		not = true
+	}
+	switch {
+	case p.peekKeyword("IN"):
+		p.next()
+		return p.parseIn(left, not)
+	case p.peekKeyword("BETWEEN"):
+		p.next()
+		return p.parseBetween(left, not)
+	case p.peekKeyword("LIKE") || p.peekKeyword("ILIKE"):
+		return p.parseLike(left, not)
+	case not:
+		return nil, fmt.Errorf("expected IN, BETWEEN, LIKE or ILIKE after NOT, got %v", p.peek())
+	}
+	// operator
+	if p.peek() == nil || p.peek().Type != lexer.TokenOperator {
+		return nil, fmt.Errorf("expected comparison operator, got %v", p.peek())
 	}
 	op := p.next().Value
 	// right operand
 	if p.peek() == nil {
 		return nil, fmt.Errorf("unexpected eof after operator")
 	}
-	switch p.peek().Type {
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &ComparisonOp{node: p.span(start), Left: left, Op: op, Right: right}, nil
+}
+
+// peekSubqueryAhead reports whether the '(' at the next position opens a subquery
+func (p *parser) peekSubqueryAhead() bool {
+	t := p.peekAhead(1)
+	return t != nil && t.Type == lexer.TokenKeyword && (strings.EqualFold(t.Value, "SELECT") || strings.EqualFold(t.Value, "WITH"))
+}
+
+// parseIn parses the list or subquery following IN
+func (p *parser) parseIn(left Expr, not bool) (Expr, error) {
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(' after IN, got %v", p.peek())
+	}
+	if p.peekSubqueryAhead() {
+		sub, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &InExpr{node: p.span(left.Pos()), Left: left, Not: not, Subquery: sub}, nil
+	}
+	p.next()
+	list := []Expr{}
+	for {
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		break
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after IN list, got %v", p.peek())
+	}
+	p.next()
+	return &InExpr{node: p.span(left.Pos()), Left: left, Not: not, List: list}, nil
+}
+
+// parseBetween parses <low> AND <high> following BETWEEN
+func (p *parser) parseBetween(expr Expr, not bool) (Expr, error) {
+	low, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	high, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &BetweenExpr{node: p.span(expr.Pos()), Expr: expr, Not: not, Low: low, High: high}, nil
+}
+
+// parseLike parses LIKE|ILIKE <pattern> [ESCAPE <escape>]
+func (p *parser) parseLike(left Expr, not bool) (Expr, error) {
+	op := strings.ToUpper(p.next().Value)
+	pattern, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	var escape Expr
+	if p.peekKeyword("ESCAPE") {
+		p.next()
+		if p.peek() == nil || p.peek().Type != lexer.TokenString {
+			return nil, fmt.Errorf("expected string after ESCAPE, got %v", p.peek())
+		}
+		start := p.peekPos()
+		v := p.next().Value
+		escape = &LiteralString{node: p.span(start), Value: v}
+	}
+	return &LikeExpr{node: p.span(left.Pos()), Left: left, Not: not, Op: op, Pattern: pattern, Escape: escape}, nil
+}
+
+// parseOperand parses a primary operand followed by any number of ::type casts
+func (p *parser) parseOperand() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() != nil && p.peek().Type == lexer.TokenOperator && p.peek().Value == "::" {
+		p.next()
+		typ, err := p.parseDataType()
+		if err != nil {
+			return nil, err
+		}
+		expr = &CastExpr{node: p.span(expr.Pos()), Expr: expr, Type: typ}
+	}
+	return expr, nil
+}
+
+// parsePrimary parses a literal, a column reference, a scalar subquery,
+// a CASE expression or a CAST
+func (p *parser) parsePrimary() (Expr, error) {
+	start := p.peekPos()
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected eof in expression")
+	}
+	switch t.Type {
 	case lexer.TokenNumber:
 		v := p.next().Value
 		if strings.Contains(v, ".") {
@@ -279,46 +1297,309 @@ func (p *parser) parseComparison() (Expr, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &ComparisonOp{Left: left, Op: op, Right: &LiteralInt{Value: u}}, nil
+		return &LiteralInt{node: p.span(start), Value: u}, nil
 	case lexer.TokenString:
-		s := p.next().Value
-		return &ComparisonOp{Left: left, Op: op, Right: &LiteralString{Value: s}}, nil
+		v := p.next().Value
+		return &LiteralString{node: p.span(start), Value: v}, nil
+	case lexer.TokenParam:
+		return p.parseParam()
+	case lexer.TokenKeyword:
+		if p.consumeKeyword("NULL") {
+			return &LiteralNull{node: p.span(start)}, nil
+		}
 	case lexer.TokenIdentifier:
-		r := &ColumnRef{Name: p.next().Value}
-		return &ComparisonOp{Left: left, Op: op, Right: r}, nil
-	default:
-		return nil, fmt.Errorf("unexpected token on right side of comparison: %v", p.peek())
+		if p.peekCallAhead() {
+			return p.parseFuncCall()
+		}
+		name := p.next().Value
+		return &ColumnRef{node: p.span(start), Name: name}, nil
+	}
+	switch {
+	case p.peekSeparator("("):
+		sub, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &SubqueryExpr{node: p.span(start), Select: sub}, nil
+	case p.peekKeyword("CASE"):
+		return p.parseCase()
+	case p.peekKeyword("CAST"):
+		return p.parseCast()
 	}
+	return nil, fmt.Errorf("unexpected token in expression: %v", t)
 }
 
-func (p *parser) parseInsert() (AstNode, error) {
-	// consume INSERT
+// parseParam converts a bind parameter token into a Param
+func (p *parser) parseParam() (Expr, error) {
+	start := p.peekPos()
+	v := p.next().Value
+	switch v[0] {
+	case '?':
+		p.params++
+		return &Param{node: p.span(start), Style: ParamQuestion, Position: p.params}, nil
+	case '$':
+		n, err := strconv.Atoi(v[1:])
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid parameter %s", v)
+		}
+		return &Param{node: p.span(start), Style: ParamDollar, Position: n}, nil
+	}
+	return &Param{node: p.span(start), Style: ParamNamed, Name: v[1:]}, nil
+}
+
+// parseCase parses both simple (CASE x WHEN 1 THEN ...) and searched
+// (CASE WHEN x = 1 THEN ...) CASE expressions
+func (p *parser) parseCase() (Expr, error) {
+	c := &CaseExpr{node: node{pos: p.peekPos()}}
+	// consume CASE
 	p.next()
-	if err := p.expectKeyword("INTO"); err != nil {
-		return nil, err
+	if !p.peekKeyword("WHEN") {
+		operand, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		c.Operand = operand
 	}
-	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
-		return nil, fmt.Errorf("expected table name after INTO")
+	for p.peekKeyword("WHEN") {
+		p.next()
+		var cond Expr
+		var err error
+		if c.Operand != nil {
+			cond, err = p.parseOperand()
+		} else {
+			cond, err = p.parseLogical()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		result, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, WhenClause{Cond: cond, Result: result})
 	}
-	table := p.next().Value
-	// optional column list - skip if present
-	if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "(" {
+	if len(c.Whens) == 0 {
+		return nil, fmt.Errorf("expected at least one WHEN in CASE, got %v", p.peek())
+	}
+	if p.peekKeyword("ELSE") {
 		p.next()
-		for {
-			if p.peek() == nil {
-				return nil, fmt.Errorf("unexpected eof in column list")
-			}
-			if p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")" {
-				p.next()
-				break
-			}
-			p.next()
-			if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "," {
-				p.next()
-			}
+		e, err := p.parseOperand()
+		if err != nil {
+			return nil, err
 		}
+		c.Else = e
 	}
-	if err := p.expectKeyword("VALUES"); err != nil {
+	if err := p.expectKeyword("END"); err != nil {
+		return nil, err
+	}
+	c.setEnd(p.lastEnd())
+	return c, nil
+}
+
+// parseFuncCall parses name([args | *]) [OVER (spec) | OVER name]
+func (p *parser) parseFuncCall() (Expr, error) {
+	call := &FuncCall{node: node{pos: p.peekPos()}}
+	call.Name = p.next().Value
+	// consume (
+	p.next()
+	if p.peekSeparator("*") {
+		p.next()
+		call.Star = true
+	} else if !p.peekSeparator(")") {
+		for {
+			arg, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if p.peekSeparator(",") {
+				p.next()
+				continue
+			}
+			break
+		}
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after arguments of %s, got %v", call.Name, p.peek())
+	}
+	p.next()
+	if p.consumeKeyword("OVER") {
+		if p.peek() != nil && p.peek().Type == lexer.TokenIdentifier {
+			call.Over = &WindowSpec{Name: p.next().Value}
+			call.setEnd(p.lastEnd())
+			return call, nil
+		}
+		spec, err := p.parseWindowSpec()
+		if err != nil {
+			return nil, err
+		}
+		call.Over = spec
+	}
+	call.setEnd(p.lastEnd())
+	return call, nil
+}
+
+// parseWindowSpec parses ( [name] [PARTITION BY ...] [ORDER BY ...] [frame] )
+func (p *parser) parseWindowSpec() (*WindowSpec, error) {
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(' to start window specification, got %v", p.peek())
+	}
+	p.next()
+	spec := &WindowSpec{}
+	if p.peek() != nil && p.peek().Type == lexer.TokenIdentifier && !p.peekWord("ROWS") && !p.peekWord("RANGE") {
+		spec.Name = p.next().Value
+	}
+	if p.consumeKeyword("PARTITION") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			expr, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			spec.PartitionBy = append(spec.PartitionBy, expr)
+			if p.peekSeparator(",") {
+				p.next()
+				continue
+			}
+			break
+		}
+	}
+	if p.consumeKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		items, err := p.parseOrderByList()
+		if err != nil {
+			return nil, err
+		}
+		spec.OrderBy = items
+	}
+	if p.peekWord("ROWS") || p.peekWord("RANGE") {
+		frame, err := p.parseWindowFrame()
+		if err != nil {
+			return nil, err
+		}
+		spec.Frame = frame
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after window specification, got %v", p.peek())
+	}
+	p.next()
+	return spec, nil
+}
+
+// parseWindowFrame parses ROWS|RANGE <bound> or ROWS|RANGE BETWEEN <bound> AND <bound>
+func (p *parser) parseWindowFrame() (*WindowFrame, error) {
+	frame := &WindowFrame{Unit: strings.ToUpper(p.next().Value)}
+	if !p.consumeKeyword("BETWEEN") {
+		start, err := p.parseFrameBound()
+		if err != nil {
+			return nil, err
+		}
+		frame.Start = start
+		return frame, nil
+	}
+	start, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	end, err := p.parseFrameBound()
+	if err != nil {
+		return nil, err
+	}
+	frame.Start = start
+	frame.End = &end
+	return frame, nil
+}
+
+// parseFrameBound parses UNBOUNDED PRECEDING|FOLLOWING, CURRENT ROW or <n> PRECEDING|FOLLOWING
+func (p *parser) parseFrameBound() (FrameBound, error) {
+	switch {
+	case p.consumeWord("UNBOUNDED"):
+		if p.consumeWord("PRECEDING") {
+			return FrameBound{Kind: "UNBOUNDED PRECEDING"}, nil
+		}
+		if p.consumeWord("FOLLOWING") {
+			return FrameBound{Kind: "UNBOUNDED FOLLOWING"}, nil
+		}
+		return FrameBound{}, fmt.Errorf("expected PRECEDING or FOLLOWING after UNBOUNDED, got %v", p.peek())
+	case p.consumeWord("CURRENT"):
+		if !p.consumeWord("ROW") {
+			return FrameBound{}, fmt.Errorf("expected ROW after CURRENT, got %v", p.peek())
+		}
+		return FrameBound{Kind: "CURRENT ROW"}, nil
+	}
+	if p.peek() == nil || p.peek().Type != lexer.TokenNumber {
+		return FrameBound{}, fmt.Errorf("expected frame bound, got %v", p.peek())
+	}
+	offset, err := p.parseOperand()
+	if err != nil {
+		return FrameBound{}, err
+	}
+	if p.consumeWord("PRECEDING") {
+		return FrameBound{Kind: "PRECEDING", Offset: offset}, nil
+	}
+	if p.consumeWord("FOLLOWING") {
+		return FrameBound{Kind: "FOLLOWING", Offset: offset}, nil
+	}
+	return FrameBound{}, fmt.Errorf("expected PRECEDING or FOLLOWING after frame offset, got %v", p.peek())
+}
+
+// parseCast parses CAST ( <expr> AS <type> )
+func (p *parser) parseCast() (Expr, error) {
+	start := p.peekPos()
+	// consume CAST
+	p.next()
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(' after CAST, got %v", p.peek())
+	}
+	p.next()
+	expr, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	typ, err := p.parseDataType()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after CAST type, got %v", p.peek())
+	}
+	p.next()
+	return &CastExpr{node: p.span(start), Expr: expr, Type: typ}, nil
+}
+
+func (p *parser) parseInsert() (*InsertStmt, error) {
+	// consume INSERT
+	p.next()
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return nil, fmt.Errorf("expected table name after INTO")
+	}
+	table := p.next().Value
+	// optional column list
+	var columns []string
+	if p.peekSeparator("(") {
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		columns = cols
+	}
+	if err := p.expectKeyword("VALUES"); err != nil {
 		return nil, err
 	}
 	// expect (
@@ -329,173 +1610,1461 @@ func (p *parser) parseInsert() (AstNode, error) {
 	vals := []Expr{}
 	hasValues := false
 	for {
-		if p.peek() == nil {
-			return nil, fmt.Errorf("unexpected eof in values")
-		}
-		if p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")" {
-			if !hasValues {
-				return nil, fmt.Errorf("expected at least one value in VALUES list")
+		if p.peek() == nil {
+			return nil, fmt.Errorf("unexpected eof in values")
+		}
+		if p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")" {
+			if !hasValues {
+				return nil, fmt.Errorf("expected at least one value in VALUES list")
+			}
+			break
+		}
+		val, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+		hasValues = true
+		if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "," {
+			p.next()
+			continue
+		}
+		break
+	}
+	// expect )
+	if p.peek() == nil || !(p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")") {
+		return nil, fmt.Errorf("expected ')' after values list")
+	}
+	p.next()
+	ins := &InsertStmt{TableName: table, Columns: columns, Values: vals}
+	if p.consumeKeyword("ON") {
+		oc, err := p.parseOnConflict()
+		if err != nil {
+			return nil, err
+		}
+		ins.OnConflict = oc
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	ins.Returning = returning
+	return ins, nil
+}
+
+// parseUpdate parses UPDATE table SET assignments [WHERE condition] [RETURNING ...]
+func (p *parser) parseUpdate() (*UpdateStmt, error) {
+	// consume UPDATE
+	p.next()
+	table, err := p.expectIdentifier("table name after UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	if !p.consumeWord("SET") {
+		return nil, fmt.Errorf("expected SET after UPDATE %s, got %v", table, p.peek())
+	}
+	set, err := p.parseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	upd := &UpdateStmt{TableName: table, Set: set}
+	if p.consumeKeyword("WHERE") {
+		where, err := p.parseLogical()
+		if err != nil {
+			return nil, err
+		}
+		upd.Selection = where
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	upd.Returning = returning
+	return upd, nil
+}
+
+// parseDelete parses DELETE FROM table [WHERE condition] [RETURNING ...]
+func (p *parser) parseDelete() (*DeleteStmt, error) {
+	// consume DELETE
+	p.next()
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectIdentifier("table name after DELETE FROM")
+	if err != nil {
+		return nil, err
+	}
+	del := &DeleteStmt{TableName: table}
+	if p.consumeKeyword("WHERE") {
+		where, err := p.parseLogical()
+		if err != nil {
+			return nil, err
+		}
+		del.Selection = where
+	}
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	del.Returning = returning
+	return del, nil
+}
+
+// parseOnConflict parses the remainder of an ON CONFLICT clause after ON
+func (p *parser) parseOnConflict() (*OnConflict, error) {
+	if !p.consumeWord("CONFLICT") {
+		return nil, fmt.Errorf("expected CONFLICT after ON, got %v", p.peek())
+	}
+	oc := &OnConflict{}
+	switch {
+	case p.peekSeparator("("):
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		oc.Columns = cols
+	case p.consumeKeyword("ON"):
+		if !p.consumeKeyword("CONSTRAINT") {
+			return nil, fmt.Errorf("expected CONSTRAINT after ON CONFLICT ON, got %v", p.peek())
+		}
+		name, err := p.expectIdentifier("constraint name")
+		if err != nil {
+			return nil, err
+		}
+		oc.Constraint = name
+	}
+	if !p.consumeWord("DO") {
+		return nil, fmt.Errorf("expected DO in ON CONFLICT clause, got %v", p.peek())
+	}
+	if p.consumeWord("NOTHING") {
+		oc.DoNothing = true
+		return oc, nil
+	}
+	if !p.consumeKeyword("UPDATE") {
+		return nil, fmt.Errorf("expected NOTHING or UPDATE after DO, got %v", p.peek())
+	}
+	if oc.Columns == nil && oc.Constraint == "" {
+		return nil, fmt.Errorf("ON CONFLICT DO UPDATE requires a conflict target")
+	}
+	if !p.consumeWord("SET") {
+		return nil, fmt.Errorf("expected SET after DO UPDATE, got %v", p.peek())
+	}
+	set, err := p.parseAssignments()
+	if err != nil {
+		return nil, err
+	}
+	oc.Set = set
+	if p.consumeKeyword("WHERE") {
+		where, err := p.parseLogical()
+		if err != nil {
+			return nil, err
+		}
+		oc.Where = where
+	}
+	return oc, nil
+}
+
+// parseAssignments parses col = value {, col = value}
+func (p *parser) parseAssignments() ([]Assignment, error) {
+	var out []Assignment
+	for {
+		col, err := p.expectIdentifier("column name in SET")
+		if err != nil {
+			return nil, err
+		}
+		t := p.peek()
+		if t == nil || t.Type != lexer.TokenOperator || t.Value != "=" {
+			return nil, fmt.Errorf("expected '=' after %s in SET, got %v", col, t)
+		}
+		p.next()
+		val, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Assignment{Column: col, Value: val})
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		return out, nil
+	}
+}
+
+// parseCreate dispatches on the object kind following CREATE
+func (p *parser) parseCreate() (Statement, error) {
+	// consume CREATE
+	p.next()
+	if p.peekKeyword("UNIQUE") || p.peekKeyword("INDEX") {
+		return p.parseCreateIndex()
+	}
+	if p.peekKeyword("OR") || p.peekKeyword("MATERIALIZED") || p.peekKeyword("VIEW") {
+		return p.parseCreateView()
+	}
+	return p.parseCreateTable()
+}
+
+func (p *parser) parseCreateView() (Statement, error) {
+	stmt := &CreateViewStmt{}
+	if p.consumeKeyword("OR") {
+		if !p.consumeWord("REPLACE") {
+			return nil, fmt.Errorf("expected REPLACE after CREATE OR, got %v", p.peek())
+		}
+		stmt.OrReplace = true
+	}
+	stmt.Materialized = p.consumeKeyword("MATERIALIZED")
+	if stmt.OrReplace && stmt.Materialized {
+		return nil, fmt.Errorf("OR REPLACE is not supported for materialized views")
+	}
+	if err := p.expectKeyword("VIEW"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdentifier("view name")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = name
+	if p.peekSeparator("(") {
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Columns = cols
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	if !p.peekKeyword("SELECT") && !p.peekKeyword("WITH") && !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected SELECT after AS, got %v", p.peek())
+	}
+	query, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Query = query
+	return stmt, nil
+}
+
+// parseRefresh parses REFRESH MATERIALIZED VIEW name
+func (p *parser) parseRefresh() (Statement, error) {
+	// consume REFRESH
+	p.next()
+	if err := p.expectKeyword("MATERIALIZED"); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("VIEW"); err != nil {
+		return nil, err
+	}
+	name, err := p.expectIdentifier("view name")
+	if err != nil {
+		return nil, err
+	}
+	return &RefreshMaterializedViewStmt{Name: name}, nil
+}
+
+// parseDrop dispatches on the object kind following DROP
+func (p *parser) parseDrop() (Statement, error) {
+	// consume DROP
+	p.next()
+	if p.consumeKeyword("INDEX") {
+		ifExists, err := p.parseIfExists()
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.expectIdentifier("index name after DROP INDEX")
+		if err != nil {
+			return nil, err
+		}
+		return &DropIndexStmt{Name: name, IfExists: ifExists}, nil
+	}
+	return nil, fmt.Errorf("unsupported DROP of %v", p.peek())
+}
+
+func (p *parser) parseCreateIndex() (Statement, error) {
+	stmt := &CreateIndexStmt{Unique: p.consumeKeyword("UNIQUE")}
+	if err := p.expectKeyword("INDEX"); err != nil {
+		return nil, err
+	}
+	ifNotExists, err := p.parseIfNotExists()
+	if err != nil {
+		return nil, err
+	}
+	stmt.IfNotExists = ifNotExists
+	name, err := p.expectIdentifier("index name after CREATE INDEX")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = name
+	if err := p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectIdentifier("table name after ON")
+	if err != nil {
+		return nil, err
+	}
+	stmt.TableName = table
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(' after table name, got %v", p.peek())
+	}
+	p.next()
+	for {
+		col, err := p.expectIdentifier("index column name")
+		if err != nil {
+			return nil, err
+		}
+		ic := IndexColumn{Name: col}
+		if p.consumeKeyword("DESC") {
+			ic.Desc = true
+		} else {
+			p.consumeKeyword("ASC")
+		}
+		stmt.Columns = append(stmt.Columns, ic)
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		break
+	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after index columns, got %v", p.peek())
+	}
+	p.next()
+	if p.consumeKeyword("WHERE") {
+		expr, err := p.parseLogical()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = expr
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseCreateTable() (Statement, error) {
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	ifNotExists, err := p.parseIfNotExists()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return nil, fmt.Errorf("expected table name after CREATE TABLE")
+	}
+	table := p.next().Value
+	// CREATE TABLE ... AS SELECT
+	if p.consumeKeyword("AS") {
+		if !p.peekKeyword("SELECT") && !p.peekKeyword("WITH") && !p.peekSeparator("(") {
+			return nil, fmt.Errorf("expected SELECT after AS, got %v", p.peek())
+		}
+		sel, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		return &CreateTableStmt{TableName: table, IfNotExists: ifNotExists, AsSelect: sel}, nil
+	}
+	if p.peek() == nil || !(p.peek().Type == lexer.TokenSeparator && p.peek().Value == "(") {
+		return nil, fmt.Errorf("expected '(' after table name")
+	}
+	p.next()
+	cols := []ColumnDef{}
+	var constraints []TableConstraint
+	hasColumns := false
+	for {
+		if p.peek() == nil {
+			return nil, fmt.Errorf("unexpected eof in column definitions")
+		}
+		if p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")" {
+			if !hasColumns {
+				return nil, fmt.Errorf("expected at least one column definition")
+			}
+			p.next()
+			break
+		}
+		if p.peekTableConstraint() {
+			c, err := p.parseTableConstraint()
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, c)
+		} else {
+			col, err := p.parseColumnDef()
+			if err != nil {
+				return nil, err
+			}
+			cols = append(cols, col)
+			hasColumns = true
+		}
+		if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "," {
+			p.next()
+			continue
+		}
+	}
+	return &CreateTableStmt{TableName: table, IfNotExists: ifNotExists, Columns: cols, Constraints: constraints}, nil
+}
+
+func (p *parser) parseAlterTable() (Statement, error) {
+	// consume ALTER
+	p.next()
+	if err := p.expectKeyword("TABLE"); err != nil {
+		return nil, err
+	}
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return nil, fmt.Errorf("expected table name after ALTER TABLE")
+	}
+	stmt := &AlterTableStmt{TableName: p.next().Value}
+	for {
+		action, err := p.parseAlterTableAction()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Actions = append(stmt.Actions, action)
+		if p.peekSeparator(",") {
+			p.next()
+			continue
+		}
+		return stmt, nil
+	}
+}
+
+// parseAlterTableAction parses one ADD, DROP, RENAME or ALTER COLUMN action
+func (p *parser) parseAlterTableAction() (AlterTableAction, error) {
+	switch {
+	case p.consumeWord("ADD"):
+		if p.peekTableConstraint() {
+			c, err := p.parseTableConstraint()
+			if err != nil {
+				return AlterTableAction{}, err
+			}
+			return AlterTableAction{Type: "ADD CONSTRAINT", Constraint: &c}, nil
+		}
+		p.consumeWord("COLUMN")
+		col, err := p.parseColumnDef()
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		return AlterTableAction{Type: "ADD COLUMN", Column: &col}, nil
+	case p.consumeKeyword("DROP"):
+		if p.consumeKeyword("CONSTRAINT") {
+			ifExists, err := p.parseIfExists()
+			if err != nil {
+				return AlterTableAction{}, err
+			}
+			name, err := p.expectIdentifier("constraint name")
+			if err != nil {
+				return AlterTableAction{}, err
+			}
+			return AlterTableAction{Type: "DROP CONSTRAINT", ConstraintName: name, IfExists: ifExists}, nil
+		}
+		p.consumeWord("COLUMN")
+		ifExists, err := p.parseIfExists()
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		name, err := p.expectIdentifier("column name")
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		return AlterTableAction{Type: "DROP COLUMN", ColumnName: name, IfExists: ifExists}, nil
+	case p.consumeWord("RENAME"):
+		if p.consumeWord("TO") {
+			name, err := p.expectIdentifier("new table name")
+			if err != nil {
+				return AlterTableAction{}, err
+			}
+			return AlterTableAction{Type: "RENAME TO", NewName: name}, nil
+		}
+		p.consumeWord("COLUMN")
+		name, err := p.expectIdentifier("column name")
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		if !p.consumeWord("TO") {
+			return AlterTableAction{}, fmt.Errorf("expected TO after RENAME COLUMN %s, got %v", name, p.peek())
+		}
+		newName, err := p.expectIdentifier("new column name")
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		return AlterTableAction{Type: "RENAME COLUMN", ColumnName: name, NewName: newName}, nil
+	case p.consumeKeyword("ALTER"):
+		p.consumeWord("COLUMN")
+		name, err := p.expectIdentifier("column name")
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		return p.parseAlterColumn(name)
+	}
+	return AlterTableAction{}, fmt.Errorf("expected ADD, DROP, RENAME or ALTER in ALTER TABLE, got %v", p.peek())
+}
+
+// parseAlterColumn parses the change applied by ALTER COLUMN <name>
+func (p *parser) parseAlterColumn(name string) (AlterTableAction, error) {
+	switch {
+	case p.consumeWord("TYPE"):
+		typ, err := p.parseDataType()
+		if err != nil {
+			return AlterTableAction{}, err
+		}
+		return AlterTableAction{Type: "ALTER COLUMN TYPE", ColumnName: name, DataType: typ}, nil
+	case p.consumeWord("SET"):
+		if p.consumeKeyword("DEFAULT") {
+			expr, err := p.parseOperand()
+			if err != nil {
+				return AlterTableAction{}, err
+			}
+			return AlterTableAction{Type: "SET DEFAULT", ColumnName: name, Default: expr}, nil
+		}
+		if p.consumeKeyword("NOT") {
+			if err := p.expectKeyword("NULL"); err != nil {
+				return AlterTableAction{}, err
+			}
+			return AlterTableAction{Type: "SET NOT NULL", ColumnName: name}, nil
+		}
+		return AlterTableAction{}, fmt.Errorf("expected DEFAULT or NOT NULL after SET, got %v", p.peek())
+	case p.consumeKeyword("DROP"):
+		if p.consumeKeyword("DEFAULT") {
+			return AlterTableAction{Type: "DROP DEFAULT", ColumnName: name}, nil
+		}
+		if p.consumeKeyword("NOT") {
+			if err := p.expectKeyword("NULL"); err != nil {
+				return AlterTableAction{}, err
+			}
+			return AlterTableAction{Type: "DROP NOT NULL", ColumnName: name}, nil
+		}
+		return AlterTableAction{}, fmt.Errorf("expected DEFAULT or NOT NULL after DROP, got %v", p.peek())
+	}
+	return AlterTableAction{}, fmt.Errorf("expected TYPE, SET or DROP after ALTER COLUMN %s, got %v", name, p.peek())
+}
+
+// expectIdentifier consumes an identifier, naming what was expected in the error
+func (p *parser) expectIdentifier(what string) (string, error) {
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return "", fmt.Errorf("expected %s, got %v", what, p.peek())
+	}
+	return p.next().Value, nil
+}
+
+// parsePrepare parses PREPARE name [(type, ...)] AS statement
+func (p *parser) parsePrepare() (Statement, error) {
+	// consume PREPARE
+	p.next()
+	name, err := p.expectIdentifier("statement name after PREPARE")
+	if err != nil {
+		return nil, err
+	}
+	stmt := &PrepareStmt{Name: name}
+	if p.peekSeparator("(") {
+		p.next()
+		for {
+			typ, err := p.parseDataType()
+			if err != nil {
+				return nil, err
+			}
+			stmt.ParamTypes = append(stmt.ParamTypes, typ)
+			if p.peekSeparator(",") {
+				p.next()
+				continue
+			}
+			break
+		}
+		if !p.peekSeparator(")") {
+			return nil, fmt.Errorf("expected ')' after parameter types, got %v", p.peek())
+		}
+		p.next()
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	if p.peekKeyword("PREPARE") || p.peekKeyword("EXECUTE") || p.peekKeyword("DEALLOCATE") {
+		return nil, fmt.Errorf("cannot prepare a %s statement", strings.ToUpper(p.peek().Value))
+	}
+	inner, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Statement = inner
+	return stmt, nil
+}
+
+// parseExplain parses EXPLAIN [ANALYZE] [VERBOSE] statement
+// or EXPLAIN (option [, ...]) statement
+func (p *parser) parseExplain() (Statement, error) {
+	// consume EXPLAIN
+	p.next()
+	stmt := &ExplainStmt{}
+	if p.peekSeparator("(") && p.peekExplainOptionAhead() {
+		p.next()
+		for {
+			if err := p.parseExplainOption(stmt); err != nil {
+				return nil, err
+			}
+			if p.peekSeparator(",") {
+				p.next()
+				continue
+			}
+			break
+		}
+		if !p.peekSeparator(")") {
+			return nil, fmt.Errorf("expected ')' after EXPLAIN options, got %v", p.peek())
+		}
+		p.next()
+	} else {
+		stmt.Analyze = p.consumeWord("ANALYZE")
+		stmt.Verbose = p.consumeWord("VERBOSE")
+	}
+	if p.peek() == nil {
+		return nil, fmt.Errorf("expected statement after EXPLAIN")
+	}
+	if p.peekKeyword("EXPLAIN") {
+		return nil, fmt.Errorf("cannot explain an EXPLAIN statement")
+	}
+	inner, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Statement = inner
+	return stmt, nil
+}
+
+// peekExplainOptionAhead reports whether the token after '(' names an EXPLAIN
+// option, telling an option list apart from a parenthesized query
+func (p *parser) peekExplainOptionAhead() bool {
+	t := p.peekAhead(1)
+	if t == nil || (t.Type != lexer.TokenKeyword && t.Type != lexer.TokenIdentifier) {
+		return false
+	}
+	switch strings.ToUpper(t.Value) {
+	case "ANALYZE", "VERBOSE", "FORMAT":
+		return true
+	}
+	return false
+}
+
+// parseExplainOption parses one entry of a parenthesized EXPLAIN option list
+func (p *parser) parseExplainOption(stmt *ExplainStmt) error {
+	switch {
+	case p.consumeWord("ANALYZE"):
+		v, err := p.parseOptionalBool()
+		if err != nil {
+			return err
+		}
+		stmt.Analyze = v
+	case p.consumeWord("VERBOSE"):
+		v, err := p.parseOptionalBool()
+		if err != nil {
+			return err
+		}
+		stmt.Verbose = v
+	case p.consumeWord("FORMAT"):
+		switch {
+		case p.consumeWord("TEXT"):
+			stmt.Format = "TEXT"
+		case p.consumeWord("JSON"):
+			stmt.Format = "JSON"
+		default:
+			return fmt.Errorf("expected TEXT or JSON after FORMAT, got %v", p.peek())
+		}
+	default:
+		return fmt.Errorf("unknown EXPLAIN option %v", p.peek())
+	}
+	return nil
+}
+
+// parseOptionalBool parses an optional TRUE|FALSE|ON|OFF option value; a
+// missing value means true
+func (p *parser) parseOptionalBool() (bool, error) {
+	switch {
+	case p.consumeWord("TRUE"), p.consumeWord("ON"):
+		return true, nil
+	case p.consumeWord("FALSE"), p.consumeWord("OFF"):
+		return false, nil
+	}
+	return true, nil
+}
+
+// parseExecute parses EXECUTE name [(arg, ...)]
+func (p *parser) parseExecute() (Statement, error) {
+	// consume EXECUTE
+	p.next()
+	name, err := p.expectIdentifier("statement name after EXECUTE")
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ExecuteStmt{Name: name}
+	if p.peekSeparator("(") {
+		p.next()
+		for {
+			arg, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Args = append(stmt.Args, arg)
+			if p.peekSeparator(",") {
+				p.next()
+				continue
+			}
+			break
+		}
+		if !p.peekSeparator(")") {
+			return nil, fmt.Errorf("expected ')' after EXECUTE arguments, got %v", p.peek())
+		}
+		p.next()
+	}
+	return stmt, nil
+}
+
+// parseDeallocate parses DEALLOCATE [PREPARE] name | ALL
+func (p *parser) parseDeallocate() (Statement, error) {
+	// consume DEALLOCATE
+	p.next()
+	p.consumeKeyword("PREPARE")
+	if p.consumeKeyword("ALL") {
+		return &DeallocateStmt{All: true}, nil
+	}
+	name, err := p.expectIdentifier("statement name after DEALLOCATE")
+	if err != nil {
+		return nil, err
+	}
+	return &DeallocateStmt{Name: name}, nil
+}
+
+// parseTransactionControl parses BEGIN, START TRANSACTION, COMMIT, ROLLBACK,
+// SAVEPOINT and RELEASE SAVEPOINT
+func (p *parser) parseTransactionControl() (Statement, error) {
+	switch {
+	case p.consumeKeyword("BEGIN"):
+		p.consumeTransactionNoise()
+		return p.parseBeginOptions()
+	case p.consumeWord("START"):
+		if err := p.expectKeyword("TRANSACTION"); err != nil {
+			return nil, err
+		}
+		return p.parseBeginOptions()
+	case p.consumeKeyword("COMMIT"):
+		p.consumeTransactionNoise()
+		return &CommitStmt{}, nil
+	case p.consumeKeyword("ROLLBACK"):
+		p.consumeTransactionNoise()
+		if !p.consumeWord("TO") {
+			return &RollbackStmt{}, nil
+		}
+		p.consumeKeyword("SAVEPOINT")
+		name, err := p.expectIdentifier("savepoint name after ROLLBACK TO")
+		if err != nil {
+			return nil, err
+		}
+		return &RollbackStmt{Savepoint: name}, nil
+	case p.consumeKeyword("SAVEPOINT"):
+		name, err := p.expectIdentifier("savepoint name")
+		if err != nil {
+			return nil, err
+		}
+		return &SavepointStmt{Name: name}, nil
+	case p.consumeWord("RELEASE"):
+		p.consumeKeyword("SAVEPOINT")
+		name, err := p.expectIdentifier("savepoint name after RELEASE")
+		if err != nil {
+			return nil, err
+		}
+		return &ReleaseSavepointStmt{Name: name}, nil
+	}
+	return nil, fmt.Errorf("expected transaction statement, got %v", p.peek())
+}
+
+// consumeTransactionNoise skips the optional TRANSACTION or WORK after BEGIN, COMMIT and ROLLBACK
+func (p *parser) consumeTransactionNoise() {
+	if !p.consumeKeyword("TRANSACTION") {
+		p.consumeWord("WORK")
+	}
+}
+
+// parseBeginOptions parses [ISOLATION LEVEL <level>] after BEGIN or START TRANSACTION
+func (p *parser) parseBeginOptions() (Statement, error) {
+	stmt := &BeginStmt{}
+	if !p.consumeWord("ISOLATION") {
+		return stmt, nil
+	}
+	if !p.consumeWord("LEVEL") {
+		return nil, fmt.Errorf("expected LEVEL after ISOLATION, got %v", p.peek())
+	}
+	switch {
+	case p.consumeWord("SERIALIZABLE"):
+		stmt.IsolationLevel = "SERIALIZABLE"
+	case p.consumeWord("REPEATABLE"):
+		if !p.consumeWord("READ") {
+			return nil, fmt.Errorf("expected READ after REPEATABLE, got %v", p.peek())
+		}
+		stmt.IsolationLevel = "REPEATABLE READ"
+	case p.consumeWord("READ"):
+		if p.consumeWord("COMMITTED") {
+			stmt.IsolationLevel = "READ COMMITTED"
+		} else if p.consumeWord("UNCOMMITTED") {
+			stmt.IsolationLevel = "READ UNCOMMITTED"
+		} else {
+			return nil, fmt.Errorf("expected COMMITTED or UNCOMMITTED after READ, got %v", p.peek())
+		}
+	default:
+		return nil, fmt.Errorf("expected isolation level, got %v", p.peek())
+	}
+	return stmt, nil
+}
+
+// parseIfExists consumes an optional IF EXISTS
+func (p *parser) parseIfExists() (bool, error) {
+	if !p.consumeKeyword("IF") {
+		return false, nil
+	}
+	if err := p.expectKeyword("EXISTS"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parseIfNotExists consumes an optional IF NOT EXISTS
+func (p *parser) parseIfNotExists() (bool, error) {
+	if !p.consumeKeyword("IF") {
+		return false, nil
+	}
+	if err := p.expectKeyword("NOT"); err != nil {
+		return false, err
+	}
+	if err := p.expectKeyword("EXISTS"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parseColumnDef parses <name> <type> followed by any column constraints
+func (p *parser) parseColumnDef() (ColumnDef, error) {
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return ColumnDef{}, fmt.Errorf("expected column name, got %v", p.peek())
+	}
+	name := p.next().Value
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return ColumnDef{}, fmt.Errorf("expected column type for %s", name)
+	}
+	typ, err := p.parseDataType()
+	if err != nil {
+		return ColumnDef{}, err
+	}
+	col := ColumnDef{Name: name, Type: typ}
+	for {
+		switch {
+		case p.consumeKeyword("PRIMARY"):
+			if !p.consumeWord("KEY") {
+				return ColumnDef{}, fmt.Errorf("expected KEY after PRIMARY for column %s", name)
 			}
-			break
-		}
-		if p.peek().Type == lexer.TokenNumber {
-			v := p.next().Value
-			if strings.Contains(v, ".") {
-				v = strings.SplitN(v, ".", 2)[0]
+			col.PrimaryKey = true
+		case p.consumeKeyword("NOT"):
+			if err := p.expectKeyword("NULL"); err != nil {
+				return ColumnDef{}, err
 			}
-			u, err := strconv.ParseUint(v, 10, 64)
+			col.NotNull = true
+		case p.consumeKeyword("NULL"):
+			col.Null = true
+		case p.consumeKeyword("UNIQUE"):
+			col.Unique = true
+		case p.consumeKeyword("DEFAULT"):
+			expr, err := p.parseOperand()
 			if err != nil {
-				return nil, err
+				return ColumnDef{}, err
 			}
-			vals = append(vals, &LiteralInt{Value: u})
-			hasValues = true
-		} else if p.peek().Type == lexer.TokenString {
-			s := p.next().Value
-			vals = append(vals, &LiteralString{Value: s})
-			hasValues = true
-		} else if p.peek().Type == lexer.TokenIdentifier {
-			id := p.next().Value
-			vals = append(vals, &ColumnRef{Name: id})
-			hasValues = true
-		} else {
-			return nil, fmt.Errorf("unexpected token in VALUES: %v", p.peek())
+			col.Default = expr
+		case p.consumeKeyword("CHECK"):
+			expr, err := p.parseParenCondition()
+			if err != nil {
+				return ColumnDef{}, err
+			}
+			col.Check = expr
+		case p.consumeKeyword("REFERENCES"):
+			ref, err := p.parseReferences()
+			if err != nil {
+				return ColumnDef{}, err
+			}
+			col.References = ref
+		default:
+			if col.Null && col.NotNull {
+				return ColumnDef{}, fmt.Errorf("conflicting NULL/NOT NULL declarations for column %s", name)
+			}
+			return col, nil
 		}
-		if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "," {
-			p.next()
-			continue
+	}
+}
+
+// peekTableConstraint reports whether the next element of a CREATE TABLE body is a table constraint
+func (p *parser) peekTableConstraint() bool {
+	return p.peekKeyword("CONSTRAINT") || p.peekKeyword("PRIMARY") || p.peekKeyword("UNIQUE") ||
+		p.peekKeyword("FOREIGN") || p.peekKeyword("CHECK")
+}
+
+// parseTableConstraint parses a table-level constraint with an optional CONSTRAINT name
+func (p *parser) parseTableConstraint() (TableConstraint, error) {
+	var c TableConstraint
+	if p.consumeKeyword("CONSTRAINT") {
+		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+			return TableConstraint{}, fmt.Errorf("expected constraint name, got %v", p.peek())
 		}
-		break
+		c.Name = p.next().Value
 	}
-	// expect )
-	if p.peek() == nil || !(p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")") {
-		return nil, fmt.Errorf("expected ')' after values list")
+	switch {
+	case p.consumeKeyword("PRIMARY"):
+		if !p.consumeWord("KEY") {
+			return TableConstraint{}, fmt.Errorf("expected KEY after PRIMARY, got %v", p.peek())
+		}
+		c.Type = "PRIMARY KEY"
+	case p.consumeKeyword("UNIQUE"):
+		c.Type = "UNIQUE"
+	case p.consumeKeyword("FOREIGN"):
+		if !p.consumeWord("KEY") {
+			return TableConstraint{}, fmt.Errorf("expected KEY after FOREIGN, got %v", p.peek())
+		}
+		c.Type = "FOREIGN KEY"
+	case p.consumeKeyword("CHECK"):
+		expr, err := p.parseParenCondition()
+		if err != nil {
+			return TableConstraint{}, err
+		}
+		c.Type = "CHECK"
+		c.Check = expr
+		return c, nil
+	default:
+		return TableConstraint{}, fmt.Errorf("expected PRIMARY KEY, UNIQUE, FOREIGN KEY or CHECK, got %v", p.peek())
 	}
-	p.next()
-	return &InsertStmt{TableName: table, Values: vals}, nil
+	cols, err := p.parseIdentList()
+	if err != nil {
+		return TableConstraint{}, err
+	}
+	c.Columns = cols
+	if c.Type == "FOREIGN KEY" {
+		if err := p.expectKeyword("REFERENCES"); err != nil {
+			return TableConstraint{}, err
+		}
+		ref, err := p.parseReferences()
+		if err != nil {
+			return TableConstraint{}, err
+		}
+		c.References = ref
+	}
+	return c, nil
 }
 
-func (p *parser) parseCreateTable() (AstNode, error) {
-	// consume CREATE
+// parseParenCondition parses ( <condition> )
+func (p *parser) parseParenCondition() (Expr, error) {
+	if !p.peekSeparator("(") {
+		return nil, fmt.Errorf("expected '(', got %v", p.peek())
+	}
 	p.next()
-	if err := p.expectKeyword("TABLE"); err != nil {
+	expr, err := p.parseLogical()
+	if err != nil {
 		return nil, err
 	}
+	if !p.peekSeparator(")") {
+		return nil, fmt.Errorf("expected ')' after condition, got %v", p.peek())
+	}
+	p.next()
+	return expr, nil
+}
+
+// parseReferences parses <table> [( <column> {, <column>} )] following REFERENCES
+func (p *parser) parseReferences() (*References, error) {
 	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
-		return nil, fmt.Errorf("expected table name after CREATE TABLE")
+		return nil, fmt.Errorf("expected table name after REFERENCES, got %v", p.peek())
 	}
-	table := p.next().Value
-	if p.peek() == nil || !(p.peek().Type == lexer.TokenSeparator && p.peek().Value == "(") {
-		return nil, fmt.Errorf("expected '(' after table name")
+	ref := &References{Table: p.next().Value}
+	if p.peekSeparator("(") {
+		cols, err := p.parseIdentList()
+		if err != nil {
+			return nil, err
+		}
+		ref.Columns = cols
 	}
-	p.next()
-	cols := []ColumnDef{}
-	hasColumns := false
-	for {
-		if p.peek() == nil {
-			return nil, fmt.Errorf("unexpected eof in column definitions")
+	// ON DELETE / ON UPDATE actions, in any order
+	for p.consumeKeyword("ON") {
+		var target *string
+		switch {
+		case p.consumeKeyword("DELETE"):
+			target = &ref.OnDelete
+		case p.consumeKeyword("UPDATE"):
+			target = &ref.OnUpdate
+		default:
+			return nil, fmt.Errorf("expected DELETE or UPDATE after ON, got %v", p.peek())
 		}
-		if p.peek().Type == lexer.TokenSeparator && p.peek().Value == ")" {
-			if !hasColumns {
-				return nil, fmt.Errorf("expected at least one column definition")
-			}
-			p.next()
-			break
+		action, err := p.parseReferentialAction()
+		if err != nil {
+			return nil, err
 		}
-		if p.peek().Type != lexer.TokenIdentifier {
-			return nil, fmt.Errorf("expected column name, got %v", p.peek())
+		*target = action
+	}
+	return ref, nil
+}
+
+// parseReferentialAction parses CASCADE | RESTRICT | NO ACTION | SET NULL | SET DEFAULT
+func (p *parser) parseReferentialAction() (string, error) {
+	switch {
+	case p.consumeWord("CASCADE"):
+		return "CASCADE", nil
+	case p.consumeWord("RESTRICT"):
+		return "RESTRICT", nil
+	case p.consumeWord("NO"):
+		if !p.consumeWord("ACTION") {
+			return "", fmt.Errorf("expected ACTION after NO, got %v", p.peek())
 		}
-		name := p.next().Value
-		if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
-			return nil, fmt.Errorf("expected column type for %s", name)
+		return "NO ACTION", nil
+	case p.consumeWord("SET"):
+		if p.consumeKeyword("NULL") {
+			return "SET NULL", nil
 		}
-		typ := p.next().Value
-		cols = append(cols, ColumnDef{Name: name, Type: typ})
-		hasColumns = true
-		if p.peek() != nil && p.peek().Type == lexer.TokenSeparator && p.peek().Value == "," {
-			p.next()
-			continue
+		if p.consumeKeyword("DEFAULT") {
+			return "SET DEFAULT", nil
 		}
+		return "", fmt.Errorf("expected NULL or DEFAULT after SET, got %v", p.peek())
 	}
-	return &CreateTableStmt{TableName: table, Columns: cols}, nil
+	return "", fmt.Errorf("expected referential action, got %v", p.peek())
 }
 
 // PrintAST returns a human-readable representation of the AST nodes.
-func PrintAST(nodes []AstNode) string {
+func PrintAST(nodes []Statement) string {
 	var b strings.Builder
 	for i, n := range nodes {
 		b.WriteString(fmt.Sprintf("Node %d:\n", i))
-		switch node := n.(type) {
-		case *SelectStmt:
-			b.WriteString(formatSelect(node, "  "))
-		case *InsertStmt:
-			b.WriteString(formatInsert(node, "  "))
-		case *CreateTableStmt:
-			b.WriteString(formatCreateTable(node, "  "))
+		b.WriteString(formatStatement(n, "  "))
+	}
+	return b.String()
+}
+
+// formatStatement renders a statement block with every line indented
+func formatStatement(n Statement, indent string) string {
+	return indent + strings.ReplaceAll(n.String(), "\n", "\n"+indent) + "\n"
+}
+
+func formatExplain(es *ExplainStmt, indent string) string {
+	header := "EXPLAIN"
+	if es.Analyze {
+		header += " ANALYZE"
+	}
+	if es.Verbose {
+		header += " VERBOSE"
+	}
+	if es.Format != "" {
+		header += " FORMAT " + es.Format
+	}
+	return indent + header + "\n" + formatStatement(es.Statement, indent+"  ")
+}
+
+func formatPrepare(ps *PrepareStmt, indent string) string {
+	var b strings.Builder
+	b.WriteString(indent + "PREPARE " + ps.Name + "\n")
+	if len(ps.ParamTypes) > 0 {
+		types := make([]string, len(ps.ParamTypes))
+		for i, t := range ps.ParamTypes {
+			types[i] = t.String()
 		}
+		b.WriteString(indent + "  Parameter types: " + strings.Join(types, ", ") + "\n")
 	}
+	b.WriteString(indent + "  AS:\n")
+	b.WriteString(formatStatement(ps.Statement, indent+"    "))
 	return b.String()
 }
 
 func formatSelect(s *SelectStmt, indent string) string {
 	var b strings.Builder
+	if s.With != nil {
+		b.WriteString(formatWith(s.With, indent))
+	}
+	if s.SetOp != nil {
+		op := s.SetOp.Op
+		if s.SetOp.All {
+			op += " ALL"
+		}
+		b.WriteString(indent + op + "\n")
+		b.WriteString(indent + "  Left:\n")
+		b.WriteString(formatSelect(s.SetOp.Left, indent+"    "))
+		b.WriteString(indent + "  Right:\n")
+		b.WriteString(formatSelect(s.SetOp.Right, indent+"    "))
+		b.WriteString(formatSelectTail(s, indent))
+		return b.String()
+	}
 	b.WriteString(indent + "SELECT\n")
 	b.WriteString(indent + "  Projections:\n")
-	for _, p := range s.Projections {
-		if p.All {
-			b.WriteString(indent + "    *\n")
-		} else {
-			b.WriteString(indent + "    " + p.Column + "\n")
-		}
+	b.WriteString(formatProjections(s.Projections, indent+"    "))
+	if s.From.Subquery != nil {
+		b.WriteString(indent + "  FROM: (subquery)" + formatAlias(s.From.Alias) + "\n")
+		b.WriteString(formatSelect(s.From.Subquery, indent+"    "))
+	} else {
+		b.WriteString(indent + "  FROM: " + s.From.Name + formatAlias(s.From.Alias) + "\n")
 	}
-	b.WriteString(indent + "  FROM: " + s.From.Name + "\n")
 	if s.Selection != nil {
 		b.WriteString(indent + "  WHERE:\n")
 		b.WriteString(formatExpr(s.Selection, indent+"    ") + "\n")
 	}
+	for _, w := range s.Windows {
+		b.WriteString(indent + "  WINDOW: " + w.Name + " AS (" + formatWindowSpec(&w.Spec) + ")\n")
+	}
+	b.WriteString(formatSelectTail(s, indent))
+	return b.String()
+}
+
+func formatWindowSpec(w *WindowSpec) string {
+	var parts []string
+	if w.Name != "" {
+		parts = append(parts, w.Name)
+	}
+	if len(w.PartitionBy) > 0 {
+		items := make([]string, len(w.PartitionBy))
+		for i, e := range w.PartitionBy {
+			items[i] = e.String()
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(items, ", "))
+	}
+	if len(w.OrderBy) > 0 {
+		parts = append(parts, "ORDER BY "+formatOrderBy(w.OrderBy))
+	}
+	if w.Frame != nil {
+		if w.Frame.End != nil {
+			parts = append(parts, w.Frame.Unit+" BETWEEN "+formatFrameBound(w.Frame.Start)+" AND "+formatFrameBound(*w.Frame.End))
+		} else {
+			parts = append(parts, w.Frame.Unit+" "+formatFrameBound(w.Frame.Start))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatFrameBound(b FrameBound) string {
+	if b.Offset != nil {
+		return b.Offset.String() + " " + b.Kind
+	}
+	return b.Kind
+}
+
+// formatSelectTail prints the ORDER BY and LIMIT clauses of a query
+func formatSelectTail(s *SelectStmt, indent string) string {
+	var b strings.Builder
+	if len(s.OrderBy) > 0 {
+		b.WriteString(indent + "  ORDER BY: " + formatOrderBy(s.OrderBy) + "\n")
+	}
 	if s.Limit != nil {
 		b.WriteString(fmt.Sprintf(indent+"  LIMIT: %d\n", *s.Limit))
 	}
 	return b.String()
 }
 
+func formatOrderBy(items []OrderByItem) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = item.Expr.String()
+		if item.Desc {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatWith(w *WithClause, indent string) string {
+	var b strings.Builder
+	if w.Recursive {
+		b.WriteString(indent + "WITH RECURSIVE\n")
+	} else {
+		b.WriteString(indent + "WITH\n")
+	}
+	for _, cte := range w.CTEs {
+		name := cte.Name
+		if len(cte.Columns) > 0 {
+			name += " (" + strings.Join(cte.Columns, ", ") + ")"
+		}
+		b.WriteString(indent + "  " + name + ":\n")
+		b.WriteString(formatSelect(cte.Query, indent+"    "))
+	}
+	return b.String()
+}
+
+func formatAlias(alias string) string {
+	if alias == "" {
+		return ""
+	}
+	return " AS " + alias
+}
+
 func formatInsert(ins *InsertStmt, indent string) string {
 	var b strings.Builder
+	if ins.With != nil {
+		b.WriteString(formatWith(ins.With, indent))
+	}
 	b.WriteString(indent + "INSERT\n")
 	b.WriteString(indent + "  Table: " + ins.TableName + "\n")
+	if len(ins.Columns) > 0 {
+		b.WriteString(indent + "  Columns: " + strings.Join(ins.Columns, ", ") + "\n")
+	}
 	b.WriteString(indent + "  Values:\n")
 	for _, v := range ins.Values {
-		b.WriteString(indent + "    " + formatExprInline(v) + "\n")
+		b.WriteString(indent + "    " + v.String() + "\n")
+	}
+	if ins.OnConflict != nil {
+		b.WriteString(formatOnConflict(ins.OnConflict, indent+"  "))
+	}
+	b.WriteString(formatReturning(ins.Returning, indent+"  "))
+	return b.String()
+}
+
+func formatProjections(items []ProjectionItem, indent string) string {
+	var b strings.Builder
+	for _, p := range items {
+		switch {
+		case p.All:
+			b.WriteString(indent + "*\n")
+		case p.Expr != nil:
+			b.WriteString(indent + p.Expr.String() + formatAlias(p.Alias) + "\n")
+			if sub, ok := p.Expr.(*SubqueryExpr); ok {
+				b.WriteString(formatSelect(sub.Select, indent+"  "))
+			}
+		default:
+			b.WriteString(indent + p.Column + formatAlias(p.Alias) + "\n")
+		}
+	}
+	return b.String()
+}
+
+func formatReturning(items []ProjectionItem, indent string) string {
+	if len(items) == 0 {
+		return ""
+	}
+	return indent + "Returning:\n" + formatProjections(items, indent+"  ")
+}
+
+func formatUpdate(upd *UpdateStmt, indent string) string {
+	var b strings.Builder
+	if upd.With != nil {
+		b.WriteString(formatWith(upd.With, indent))
+	}
+	b.WriteString(indent + "UPDATE\n")
+	b.WriteString(indent + "  Table: " + upd.TableName + "\n")
+	b.WriteString(indent + "  Set:\n")
+	for _, a := range upd.Set {
+		b.WriteString(indent + "    " + a.Column + " = " + a.Value.String() + "\n")
+	}
+	if upd.Selection != nil {
+		b.WriteString(indent + "  WHERE:\n")
+		b.WriteString(formatExpr(upd.Selection, indent+"    ") + "\n")
+	}
+	b.WriteString(formatReturning(upd.Returning, indent+"  "))
+	return b.String()
+}
+
+func formatDelete(del *DeleteStmt, indent string) string {
+	var b strings.Builder
+	if del.With != nil {
+		b.WriteString(formatWith(del.With, indent))
+	}
+	b.WriteString(indent + "DELETE\n")
+	b.WriteString(indent + "  Table: " + del.TableName + "\n")
+	if del.Selection != nil {
+		b.WriteString(indent + "  WHERE:\n")
+		b.WriteString(formatExpr(del.Selection, indent+"    ") + "\n")
+	}
+	b.WriteString(formatReturning(del.Returning, indent+"  "))
+	return b.String()
+}
+
+func formatOnConflict(oc *OnConflict, indent string) string {
+	var b strings.Builder
+	header := "ON CONFLICT"
+	if len(oc.Columns) > 0 {
+		header += " (" + strings.Join(oc.Columns, ", ") + ")"
+	}
+	if oc.Constraint != "" {
+		header += " ON CONSTRAINT " + oc.Constraint
+	}
+	if oc.DoNothing {
+		return indent + header + " DO NOTHING\n"
+	}
+	b.WriteString(indent + header + " DO UPDATE\n")
+	b.WriteString(indent + "  Set:\n")
+	for _, a := range oc.Set {
+		b.WriteString(indent + "    " + a.Column + " = " + a.Value.String() + "\n")
+	}
+	if oc.Where != nil {
+		b.WriteString(indent + "  WHERE:\n")
+		b.WriteString(formatExpr(oc.Where, indent+"    ") + "\n")
 	}
 	return b.String()
 }
 
 func formatCreateTable(ct *CreateTableStmt, indent string) string {
 	var b strings.Builder
-	b.WriteString(indent + "CREATE TABLE " + ct.TableName + "\n")
+	if ct.IfNotExists {
+		b.WriteString(indent + "CREATE TABLE IF NOT EXISTS " + ct.TableName + "\n")
+	} else {
+		b.WriteString(indent + "CREATE TABLE " + ct.TableName + "\n")
+	}
+	if ct.AsSelect != nil {
+		b.WriteString(indent + "  AS:\n")
+		b.WriteString(formatSelect(ct.AsSelect, indent+"    "))
+		return b.String()
+	}
 	b.WriteString(indent + "  Columns:\n")
 	for _, c := range ct.Columns {
-		b.WriteString(indent + "    " + c.Name + " " + c.Type + "\n")
+		b.WriteString(indent + "    " + formatColumnDef(c) + "\n")
+	}
+	if len(ct.Constraints) > 0 {
+		b.WriteString(indent + "  Constraints:\n")
+		for _, c := range ct.Constraints {
+			b.WriteString(indent + "    " + formatTableConstraint(c) + "\n")
+		}
 	}
 	return b.String()
 }
 
-func formatExprInline(e Expr) string {
-	switch x := e.(type) {
-	case *ColumnRef:
-		return "col:" + x.Name
-	case *LiteralInt:
-		return fmt.Sprintf("int:%d", x.Value)
-	case *LiteralString:
-		return "str:'" + x.Value + "'"
-	case *ComparisonOp:
-		return formatExprInline(x.Left) + " " + x.Op + " " + formatExprInline(x.Right)
-	case *LogicalOp:
-		return "(" + formatExprInline(x.Left) + " " + x.Op + " " + formatExprInline(x.Right) + ")"
-	case *BinaryOp:
-		return "(" + formatExprInline(x.Left) + " " + x.Op + " " + formatExprInline(x.Right) + ")"
-	default:
-		return fmt.Sprintf("<expr %T>", e)
+func formatCreateIndex(ci *CreateIndexStmt, indent string) string {
+	var b strings.Builder
+	head := "CREATE "
+	if ci.Unique {
+		head += "UNIQUE "
+	}
+	head += "INDEX "
+	if ci.IfNotExists {
+		head += "IF NOT EXISTS "
+	}
+	b.WriteString(indent + head + ci.Name + "\n")
+	b.WriteString(indent + "  Table: " + ci.TableName + "\n")
+	b.WriteString(indent + "  Columns:\n")
+	for _, c := range ci.Columns {
+		if c.Desc {
+			b.WriteString(indent + "    " + c.Name + " DESC\n")
+		} else {
+			b.WriteString(indent + "    " + c.Name + "\n")
+		}
+	}
+	if ci.Where != nil {
+		b.WriteString(indent + "  WHERE:\n")
+		b.WriteString(formatExpr(ci.Where, indent+"    ") + "\n")
+	}
+	return b.String()
+}
+
+func formatDropIndex(di *DropIndexStmt, indent string) string {
+	if di.IfExists {
+		return indent + "DROP INDEX IF EXISTS " + di.Name + "\n"
+	}
+	return indent + "DROP INDEX " + di.Name + "\n"
+}
+
+func formatCreateView(cv *CreateViewStmt, indent string) string {
+	var b strings.Builder
+	head := "CREATE "
+	if cv.OrReplace {
+		head += "OR REPLACE "
+	}
+	if cv.Materialized {
+		head += "MATERIALIZED "
+	}
+	b.WriteString(indent + head + "VIEW " + cv.Name + "\n")
+	if len(cv.Columns) > 0 {
+		b.WriteString(indent + "  Columns: " + strings.Join(cv.Columns, ", ") + "\n")
+	}
+	b.WriteString(indent + "  AS:\n")
+	b.WriteString(formatSelect(cv.Query, indent+"    "))
+	return b.String()
+}
+
+func formatAlterTable(at *AlterTableStmt, indent string) string {
+	var b strings.Builder
+	b.WriteString(indent + "ALTER TABLE " + at.TableName + "\n")
+	b.WriteString(indent + "  Actions:\n")
+	for _, a := range at.Actions {
+		b.WriteString(indent + "    " + formatAlterTableAction(a) + "\n")
+	}
+	return b.String()
+}
+
+func formatAlterTableAction(a AlterTableAction) string {
+	ifExists := ""
+	if a.IfExists {
+		ifExists = "IF EXISTS "
+	}
+	switch a.Type {
+	case "ADD COLUMN":
+		return "ADD COLUMN " + formatColumnDef(*a.Column)
+	case "DROP COLUMN":
+		return "DROP COLUMN " + ifExists + a.ColumnName
+	case "RENAME COLUMN":
+		return "RENAME COLUMN " + a.ColumnName + " TO " + a.NewName
+	case "RENAME TO":
+		return "RENAME TO " + a.NewName
+	case "ALTER COLUMN TYPE":
+		return "ALTER COLUMN " + a.ColumnName + " TYPE " + a.DataType.String()
+	case "SET DEFAULT":
+		return "ALTER COLUMN " + a.ColumnName + " SET DEFAULT " + a.Default.String()
+	case "DROP DEFAULT", "SET NOT NULL", "DROP NOT NULL":
+		return "ALTER COLUMN " + a.ColumnName + " " + a.Type
+	case "ADD CONSTRAINT":
+		return "ADD " + formatTableConstraint(*a.Constraint)
+	case "DROP CONSTRAINT":
+		return "DROP CONSTRAINT " + ifExists + a.ConstraintName
+	}
+	return a.Type
+}
+
+func formatColumnDef(c ColumnDef) string {
+	out := c.Name + " " + c.Type.String()
+	if c.PrimaryKey {
+		out += " PRIMARY KEY"
+	}
+	if c.NotNull {
+		out += " NOT NULL"
+	}
+	if c.Null {
+		out += " NULL"
+	}
+	if c.Unique {
+		out += " UNIQUE"
+	}
+	if c.Default != nil {
+		out += " DEFAULT " + c.Default.String()
+	}
+	if c.Check != nil {
+		out += " CHECK (" + c.Check.String() + ")"
+	}
+	if c.References != nil {
+		out += " REFERENCES " + formatReferences(c.References)
+	}
+	return out
+}
+
+func formatReferences(r *References) string {
+	out := r.Table
+	if len(r.Columns) > 0 {
+		out += " (" + strings.Join(r.Columns, ", ") + ")"
+	}
+	if r.OnDelete != "" {
+		out += " ON DELETE " + r.OnDelete
+	}
+	if r.OnUpdate != "" {
+		out += " ON UPDATE " + r.OnUpdate
 	}
+	return out
+}
+
+func formatTableConstraint(c TableConstraint) string {
+	out := ""
+	if c.Name != "" {
+		out = "CONSTRAINT " + c.Name + " "
+	}
+	if c.Type == "CHECK" {
+		return out + "CHECK (" + c.Check.String() + ")"
+	}
+	out += c.Type + " (" + strings.Join(c.Columns, ", ") + ")"
+	if c.References != nil {
+		out += " REFERENCES " + formatReferences(c.References)
+	}
+	return out
+}
+
+func formatParam(p *Param) string {
+	switch p.Style {
+	case ParamDollar:
+		return fmt.Sprintf("$%d", p.Position)
+	case ParamNamed:
+		return ":" + p.Name
+	}
+	return "?"
 }
 
 func formatExpr(e Expr, indent string) string {
@@ -506,6 +3075,10 @@ func formatExpr(e Expr, indent string) string {
 		return fmt.Sprintf(indent+"Integer: %d", x.Value)
 	case *LiteralString:
 		return indent + "String: '" + x.Value + "'"
+	case *LiteralNull:
+		return indent + "Null"
+	case *Param:
+		return indent + "Param: " + formatParam(x)
 	case *ComparisonOp:
 		var b strings.Builder
 		b.WriteString(indent + "Comparison: " + x.Op + "\n")
@@ -524,7 +3097,83 @@ func formatExpr(e Expr, indent string) string {
 		b.WriteString(formatExpr(x.Left, indent+"  ") + "\n")
 		b.WriteString(formatExpr(x.Right, indent+"  "))
 		return b.String()
+	case *SubqueryExpr:
+		return indent + "Subquery:\n" + strings.TrimSuffix(formatSelect(x.Select, indent+"  "), "\n")
+	case *ExistsExpr:
+		label := "Exists:\n"
+		if x.Not {
+			label = "Not Exists:\n"
+		}
+		return indent + label + strings.TrimSuffix(formatSelect(x.Subquery, indent+"  "), "\n")
+	case *InExpr:
+		label := "In:\n"
+		if x.Not {
+			label = "Not In:\n"
+		}
+		var b strings.Builder
+		b.WriteString(indent + label)
+		b.WriteString(formatExpr(x.Left, indent+"  "))
+		if x.Subquery != nil {
+			b.WriteString("\n" + strings.TrimSuffix(formatSelect(x.Subquery, indent+"  "), "\n"))
+		}
+		for _, item := range x.List {
+			b.WriteString("\n" + formatExpr(item, indent+"  "))
+		}
+		return b.String()
+	case *BetweenExpr:
+		label := "Between:\n"
+		if x.Not {
+			label = "Not Between:\n"
+		}
+		var b strings.Builder
+		b.WriteString(indent + label)
+		b.WriteString(formatExpr(x.Expr, indent+"  ") + "\n")
+		b.WriteString(formatExpr(x.Low, indent+"  ") + "\n")
+		b.WriteString(formatExpr(x.High, indent+"  "))
+		return b.String()
+	case *LikeExpr:
+		label := x.Op
+		if x.Not {
+			label = "NOT " + x.Op
+		}
+		var b strings.Builder
+		b.WriteString(indent + "Like: " + label + "\n")
+		b.WriteString(formatExpr(x.Left, indent+"  ") + "\n")
+		b.WriteString(formatExpr(x.Pattern, indent+"  "))
+		if x.Escape != nil {
+			b.WriteString("\n" + indent + "  Escape:\n" + formatExpr(x.Escape, indent+"    "))
+		}
+		return b.String()
+	case *CaseExpr:
+		var b strings.Builder
+		b.WriteString(indent + "Case:")
+		if x.Operand != nil {
+			b.WriteString("\n" + indent + "  Operand:\n" + formatExpr(x.Operand, indent+"    "))
+		}
+		for _, w := range x.Whens {
+			b.WriteString("\n" + indent + "  When:\n" + formatExpr(w.Cond, indent+"    "))
+			b.WriteString("\n" + indent + "  Then:\n" + formatExpr(w.Result, indent+"    "))
+		}
+		if x.Else != nil {
+			b.WriteString("\n" + indent + "  Else:\n" + formatExpr(x.Else, indent+"    "))
+		}
+		return b.String()
+	case *CastExpr:
+		return indent + "Cast: " + x.Type.String() + "\n" + formatExpr(x.Expr, indent+"  ")
+	case *FuncCall:
+		var b strings.Builder
+		b.WriteString(indent + "Function: " + x.Name)
+		if x.Star {
+			b.WriteString("\n" + indent + "  *")
+		}
+		for _, arg := range x.Args {
+			b.WriteString("\n" + formatExpr(arg, indent+"  "))
+		}
+		if x.Over != nil {
+			b.WriteString("\n" + indent + "  Over: (" + formatWindowSpec(x.Over) + ")")
+		}
+		return b.String()
 	default:
-		return fmt.Sprintf(indent+"<expr %T>", e)
+		return indent + e.String()
 	}
 }
@@ -1,6 +1,9 @@
 package parser
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -170,7 +173,7 @@ func TestParseASTStructure(t *testing.T) {
 	if ct.TableName != "table_name" {
 		t.Fatalf("unexpected table name: %v", ct.TableName)
 	}
-	if len(ct.Columns) != 2 || ct.Columns[0].Name != "column_name1" || ct.Columns[1].Type != "TEXT" {
+	if len(ct.Columns) != 2 || ct.Columns[0].Name != "column_name1" || ct.Columns[1].Type.Name != "TEXT" {
 		t.Fatalf("unexpected columns: %+v", ct.Columns)
 	}
 }
@@ -253,3 +256,1755 @@ func TestParseMismatchedParentheses(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSubqueries(t *testing.T) {
+	// scalar subquery in projection and derived table in FROM
+	nodes, err := ParseString("SELECT id, (SELECT name FROM users) AS n FROM (SELECT id FROM orders) AS o;")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel, ok := nodes[0].(*SelectStmt)
+	if !ok {
+		t.Fatalf("expected SELECT node, got %T", nodes[0])
+	}
+	if len(sel.Projections) != 2 || sel.Projections[0].Column != "id" {
+		t.Fatalf("unexpected projections: %+v", sel.Projections)
+	}
+	if sub, ok := sel.Projections[1].Expr.(*SubqueryExpr); !ok || sub.Select.From.Name != "users" || sel.Projections[1].Alias != "n" {
+		t.Fatalf("expected scalar subquery AS n, got %+v", sel.Projections[1])
+	}
+	if sel.From.Subquery == nil || sel.From.Subquery.From.Name != "orders" || sel.From.Alias != "o" {
+		t.Fatalf("expected derived table AS o, got %+v", sel.From)
+	}
+
+	// IN (subquery) and NOT EXISTS
+	nodes, err = ParseString("SELECT * FROM t WHERE id NOT IN (SELECT id FROM bans) AND NOT EXISTS (SELECT * FROM locks WHERE tid = id)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel = nodes[0].(*SelectStmt)
+	logical, ok := sel.Selection.(*LogicalOp)
+	if !ok {
+		t.Fatalf("expected logical op in WHERE, got %T", sel.Selection)
+	}
+	in, ok := logical.Left.(*InExpr)
+	if !ok || !in.Not || in.Subquery.From.Name != "bans" {
+		t.Fatalf("expected NOT IN subquery, got %T %+v", logical.Left, logical.Left)
+	}
+	ex, ok := logical.Right.(*ExistsExpr)
+	if !ok || !ex.Not || ex.Subquery.Selection == nil {
+		t.Fatalf("expected NOT EXISTS subquery, got %T %+v", logical.Right, logical.Right)
+	}
+
+	// scalar subquery on the right side of a comparison
+	nodes, err = ParseString("SELECT * FROM t WHERE id = (SELECT id FROM u LIMIT 1)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	cmp, ok := nodes[0].(*SelectStmt).Selection.(*ComparisonOp)
+	if !ok {
+		t.Fatalf("expected comparison in WHERE")
+	}
+	if sub, ok := cmp.Right.(*SubqueryExpr); !ok || sub.Select.Limit == nil {
+		t.Fatalf("expected scalar subquery on right side, got %T", cmp.Right)
+	}
+
+	errCases := []string{
+		"SELECT * FROM (SELECT id FROM t)",
+		"SELECT * FROM t WHERE EXISTS (id = 1)",
+		"SELECT * FROM t WHERE id IN (SELECT id FROM u",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParsePredicates(t *testing.T) {
+	nodes, err := ParseString("SELECT * FROM t WHERE a IN (1, 'two') AND b NOT BETWEEN 1 AND 10 AND c LIKE 'ab%' ESCAPE '\\' AND d NOT ILIKE 'x%'")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	// AND is left-associative, so the last predicate is on the outermost right side
+	var preds []Expr
+	e := sel.Selection
+	for {
+		l, ok := e.(*LogicalOp)
+		if !ok {
+			preds = append([]Expr{e}, preds...)
+			break
+		}
+		preds = append([]Expr{l.Right}, preds...)
+		e = l.Left
+	}
+	if len(preds) != 4 {
+		t.Fatalf("expected 4 predicates, got %d", len(preds))
+	}
+	in, ok := preds[0].(*InExpr)
+	if !ok || in.Not || in.Subquery != nil || len(in.List) != 2 {
+		t.Fatalf("expected IN list with two values, got %T %+v", preds[0], preds[0])
+	}
+	if s, ok := in.List[1].(*LiteralString); !ok || s.Value != "two" {
+		t.Fatalf("expected second IN value 'two', got %T %+v", in.List[1], in.List[1])
+	}
+	bt, ok := preds[1].(*BetweenExpr)
+	if !ok || !bt.Not {
+		t.Fatalf("expected NOT BETWEEN, got %T %+v", preds[1], preds[1])
+	}
+	if lo, ok := bt.Low.(*LiteralInt); !ok || lo.Value != 1 {
+		t.Fatalf("expected BETWEEN low 1, got %T %+v", bt.Low, bt.Low)
+	}
+	if hi, ok := bt.High.(*LiteralInt); !ok || hi.Value != 10 {
+		t.Fatalf("expected BETWEEN high 10, got %T %+v", bt.High, bt.High)
+	}
+	like, ok := preds[2].(*LikeExpr)
+	if !ok || like.Not || like.Op != "LIKE" {
+		t.Fatalf("expected LIKE, got %T %+v", preds[2], preds[2])
+	}
+	if esc, ok := like.Escape.(*LiteralString); !ok || esc.Value != "\\" {
+		t.Fatalf("expected ESCAPE '\\', got %T %+v", like.Escape, like.Escape)
+	}
+	ilike, ok := preds[3].(*LikeExpr)
+	if !ok || !ilike.Not || ilike.Op != "ILIKE" || ilike.Escape != nil {
+		t.Fatalf("expected NOT ILIKE, got %T %+v", preds[3], preds[3])
+	}
+
+	errCases := []string{
+		"SELECT * FROM t WHERE a IN ()",
+		"SELECT * FROM t WHERE a IN (1, 2",
+		"SELECT * FROM t WHERE a BETWEEN 1",
+		"SELECT * FROM t WHERE a LIKE 'x' ESCAPE",
+		"SELECT * FROM t WHERE a NOT = 1",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseCaseAndCast(t *testing.T) {
+	nodes, err := ParseString("SELECT CASE WHEN a > 1 THEN 'big' WHEN a = 1 THEN 'one' ELSE 'small' END AS size, CAST(id AS TEXT), price::INT FROM t")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	if len(sel.Projections) != 3 {
+		t.Fatalf("expected three projections, got %+v", sel.Projections)
+	}
+	c, ok := sel.Projections[0].Expr.(*CaseExpr)
+	if !ok || c.Operand != nil || len(c.Whens) != 2 || c.Else == nil || sel.Projections[0].Alias != "size" {
+		t.Fatalf("expected searched CASE AS size, got %+v", sel.Projections[0])
+	}
+	if _, ok := c.Whens[0].Cond.(*ComparisonOp); !ok {
+		t.Fatalf("expected comparison in WHEN, got %T", c.Whens[0].Cond)
+	}
+	cast, ok := sel.Projections[1].Expr.(*CastExpr)
+	if !ok || cast.Type.Name != "TEXT" {
+		t.Fatalf("expected CAST(id AS TEXT), got %T %+v", sel.Projections[1].Expr, sel.Projections[1].Expr)
+	}
+	if col, ok := cast.Expr.(*ColumnRef); !ok || col.Name != "id" {
+		t.Fatalf("expected cast of column id, got %T", cast.Expr)
+	}
+	cast, ok = sel.Projections[2].Expr.(*CastExpr)
+	if !ok || cast.Type.Name != "INT" {
+		t.Fatalf("expected price::INT, got %T %+v", sel.Projections[2].Expr, sel.Projections[2].Expr)
+	}
+
+	// simple CASE in WHERE
+	nodes, err = ParseString("SELECT * FROM t WHERE CASE kind WHEN 1 THEN 'a' END = 'a'")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	cmp, ok := nodes[0].(*SelectStmt).Selection.(*ComparisonOp)
+	if !ok {
+		t.Fatalf("expected comparison in WHERE")
+	}
+	c, ok = cmp.Left.(*CaseExpr)
+	if !ok || c.Operand == nil || c.Else != nil {
+		t.Fatalf("expected simple CASE on left side, got %T %+v", cmp.Left, cmp.Left)
+	}
+	if _, ok := c.Whens[0].Cond.(*LiteralInt); !ok {
+		t.Fatalf("expected literal WHEN value in simple CASE, got %T", c.Whens[0].Cond)
+	}
+
+	errCases := []string{
+		"SELECT CASE END FROM t",
+		"SELECT CASE WHEN a = 1 THEN 2 FROM t",
+		"SELECT CAST(id TEXT) FROM t",
+		"SELECT CAST(id AS TEXT FROM t",
+		"SELECT id:: FROM t",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseSetOperations(t *testing.T) {
+	// INTERSECT binds tighter than UNION; ORDER BY and LIMIT apply to the whole compound
+	nodes, err := ParseString("SELECT a FROM t UNION ALL SELECT b FROM u INTERSECT SELECT c FROM v ORDER BY a DESC, b LIMIT 5;")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel, ok := nodes[0].(*SelectStmt)
+	if !ok || sel.SetOp == nil {
+		t.Fatalf("expected compound SELECT, got %T %+v", nodes[0], nodes[0])
+	}
+	if sel.SetOp.Op != "UNION" || !sel.SetOp.All {
+		t.Fatalf("expected UNION ALL at the top, got %+v", sel.SetOp)
+	}
+	if sel.SetOp.Left.From.Name != "t" {
+		t.Fatalf("expected left SELECT from t, got %+v", sel.SetOp.Left)
+	}
+	right := sel.SetOp.Right
+	if right.SetOp == nil || right.SetOp.Op != "INTERSECT" || right.SetOp.All {
+		t.Fatalf("expected INTERSECT on the right, got %+v", right)
+	}
+	if len(sel.OrderBy) != 2 || !sel.OrderBy[0].Desc || sel.OrderBy[1].Desc {
+		t.Fatalf("unexpected ORDER BY: %+v", sel.OrderBy)
+	}
+	if sel.Limit == nil || *sel.Limit != 5 {
+		t.Fatalf("expected LIMIT 5 on the compound, got %v", sel.Limit)
+	}
+	if sel.SetOp.Left.Limit != nil || right.SetOp.Right.OrderBy != nil {
+		t.Fatalf("ORDER BY/LIMIT must not attach to the last SELECT")
+	}
+
+	// UNION and EXCEPT are left-associative; parentheses override precedence
+	nodes, err = ParseString("SELECT a FROM t EXCEPT SELECT a FROM u UNION (SELECT a FROM v INTERSECT SELECT a FROM w)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel = nodes[0].(*SelectStmt)
+	if sel.SetOp.Op != "UNION" || sel.SetOp.Left.SetOp == nil || sel.SetOp.Left.SetOp.Op != "EXCEPT" {
+		t.Fatalf("expected (t EXCEPT u) UNION (...), got %+v", sel.SetOp)
+	}
+	if sel.SetOp.Right.SetOp == nil || sel.SetOp.Right.SetOp.Op != "INTERSECT" {
+		t.Fatalf("expected parenthesized INTERSECT on the right, got %+v", sel.SetOp.Right)
+	}
+
+	// plain SELECT with ORDER BY, and a compound used as a subquery
+	nodes, err = ParseString("SELECT * FROM t WHERE id IN (SELECT id FROM a UNION SELECT id FROM b) ORDER BY id")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel = nodes[0].(*SelectStmt)
+	if sel.SetOp != nil || len(sel.OrderBy) != 1 {
+		t.Fatalf("expected plain SELECT with ORDER BY, got %+v", sel)
+	}
+	if in, ok := sel.Selection.(*InExpr); !ok || in.Subquery.SetOp == nil {
+		t.Fatalf("expected compound subquery in IN, got %T", sel.Selection)
+	}
+
+	errCases := []string{
+		"SELECT a FROM t UNION",
+		"SELECT a FROM t UNION ALL INSERT INTO u VALUES (1)",
+		"SELECT a FROM t ORDER a",
+		"(SELECT a FROM t LIMIT 1) LIMIT 2",
+		"(SELECT a FROM t UNION SELECT b FROM u",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseWith(t *testing.T) {
+	nodes, err := ParseString("WITH RECURSIVE r (n) AS (SELECT n FROM seed UNION ALL SELECT n FROM r WHERE n < 10), top AS (SELECT * FROM r LIMIT 3) SELECT * FROM top;")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel, ok := nodes[0].(*SelectStmt)
+	if !ok || sel.With == nil {
+		t.Fatalf("expected SELECT with WITH clause, got %T %+v", nodes[0], nodes[0])
+	}
+	if !sel.With.Recursive || len(sel.With.CTEs) != 2 {
+		t.Fatalf("expected two recursive CTEs, got %+v", sel.With)
+	}
+	r := sel.With.CTEs[0]
+	if r.Name != "r" || len(r.Columns) != 1 || r.Columns[0] != "n" {
+		t.Fatalf("unexpected first CTE: %+v", r)
+	}
+	if r.Query.SetOp == nil || r.Query.SetOp.Op != "UNION" || !r.Query.SetOp.All {
+		t.Fatalf("expected UNION ALL body in recursive CTE, got %+v", r.Query)
+	}
+	if top := sel.With.CTEs[1]; top.Name != "top" || top.Columns != nil || top.Query.Limit == nil {
+		t.Fatalf("unexpected second CTE: %+v", top)
+	}
+	if sel.From.Name != "top" {
+		t.Fatalf("expected main query FROM top, got %v", sel.From.Name)
+	}
+
+	// WITH before INSERT and inside a subquery
+	nodes, err = ParseString("WITH ids AS (SELECT id FROM t) INSERT INTO log VALUES (1)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ins, ok := nodes[0].(*InsertStmt)
+	if !ok || ins.With == nil || ins.With.Recursive || ins.With.CTEs[0].Name != "ids" {
+		t.Fatalf("expected INSERT with WITH clause, got %T %+v", nodes[0], nodes[0])
+	}
+	nodes, err = ParseString("SELECT * FROM t WHERE id IN (WITH x AS (SELECT id FROM u) SELECT id FROM x)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if in, ok := nodes[0].(*SelectStmt).Selection.(*InExpr); !ok || in.Subquery.With == nil {
+		t.Fatalf("expected WITH inside IN subquery, got %T", nodes[0].(*SelectStmt).Selection)
+	}
+
+	errCases := []string{
+		"WITH x AS SELECT 1 FROM t SELECT * FROM x",
+		"WITH x (a, AS (SELECT a FROM t) SELECT * FROM x",
+		"WITH x AS (SELECT a FROM t)",
+		"WITH x AS (SELECT a FROM t) WITH y AS (SELECT b FROM u) SELECT * FROM y",
+		"WITH x AS (SELECT a FROM t) (WITH y AS (SELECT b FROM u) SELECT * FROM y)",
+		"WITH x AS (SELECT a FROM t) CREATE TABLE y (id INT)",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseWindowFunctions(t *testing.T) {
+	nodes, err := ParseString("SELECT ROW_NUMBER() OVER (PARTITION BY dept ORDER BY salary DESC ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS rn, count(*) OVER w, sum(salary) OVER (w RANGE 2 PRECEDING) FROM emp WINDOW w AS (PARTITION BY dept, team)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	if len(sel.Projections) != 3 {
+		t.Fatalf("expected three projections, got %+v", sel.Projections)
+	}
+	rn, ok := sel.Projections[0].Expr.(*FuncCall)
+	if !ok || rn.Name != "ROW_NUMBER" || len(rn.Args) != 0 || rn.Over == nil || sel.Projections[0].Alias != "rn" {
+		t.Fatalf("expected ROW_NUMBER() OVER (...) AS rn, got %+v", sel.Projections[0])
+	}
+	if len(rn.Over.PartitionBy) != 1 || len(rn.Over.OrderBy) != 1 || !rn.Over.OrderBy[0].Desc {
+		t.Fatalf("unexpected window spec: %+v", rn.Over)
+	}
+	frame := rn.Over.Frame
+	if frame == nil || frame.Unit != "ROWS" || frame.Start.Kind != "UNBOUNDED PRECEDING" || frame.End == nil || frame.End.Kind != "CURRENT ROW" {
+		t.Fatalf("unexpected window frame: %+v", frame)
+	}
+	count, ok := sel.Projections[1].Expr.(*FuncCall)
+	if !ok || !count.Star || count.Over == nil || count.Over.Name != "w" {
+		t.Fatalf("expected count(*) OVER w, got %+v", sel.Projections[1].Expr)
+	}
+	sum, ok := sel.Projections[2].Expr.(*FuncCall)
+	if !ok || len(sum.Args) != 1 || sum.Over == nil || sum.Over.Name != "w" {
+		t.Fatalf("expected sum(salary) OVER (w ...), got %+v", sel.Projections[2].Expr)
+	}
+	if f := sum.Over.Frame; f == nil || f.Unit != "RANGE" || f.Start.Kind != "PRECEDING" || f.End != nil {
+		t.Fatalf("expected RANGE 2 PRECEDING frame, got %+v", sum.Over.Frame)
+	}
+	if off, ok := sum.Over.Frame.Start.Offset.(*LiteralInt); !ok || off.Value != 2 {
+		t.Fatalf("expected frame offset 2, got %T", sum.Over.Frame.Start.Offset)
+	}
+	if len(sel.Windows) != 1 || sel.Windows[0].Name != "w" || len(sel.Windows[0].Spec.PartitionBy) != 2 {
+		t.Fatalf("unexpected WINDOW clause: %+v", sel.Windows)
+	}
+
+	// plain function call without a window in WHERE
+	nodes, err = ParseString("SELECT * FROM t WHERE lower(name) = 'bob'")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if cmp, ok := nodes[0].(*SelectStmt).Selection.(*ComparisonOp); !ok {
+		t.Fatalf("expected comparison in WHERE")
+	} else if f, ok := cmp.Left.(*FuncCall); !ok || f.Name != "lower" || f.Over != nil {
+		t.Fatalf("expected lower(name) on left side, got %T %+v", cmp.Left, cmp.Left)
+	}
+
+	errCases := []string{
+		"SELECT rank() OVER FROM t",
+		"SELECT rank() OVER (ORDER BY a FROM t",
+		"SELECT rank() OVER (ROWS BETWEEN UNBOUNDED AND CURRENT ROW) FROM t",
+		"SELECT rank() OVER (ROWS CURRENT) FROM t",
+		"SELECT rank() OVER (ROWS 1) FROM t",
+		"SELECT a FROM t WINDOW w (PARTITION BY a)",
+		"SELECT f(a FROM t",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseColumnConstraints(t *testing.T) {
+	nodes, err := ParseString("CREATE TABLE t (id INT PRIMARY KEY NOT NULL, name TEXT UNIQUE DEFAULT 'x', age INT NULL CHECK (age >= 0 AND age < 200), owner INT REFERENCES users(id), note TEXT DEFAULT NULL);")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ct := nodes[0].(*CreateTableStmt)
+	if len(ct.Columns) != 5 {
+		t.Fatalf("expected five columns, got %+v", ct.Columns)
+	}
+	id := ct.Columns[0]
+	if id.Name != "id" || id.Type.Name != "INT" || !id.PrimaryKey || !id.NotNull || id.Unique {
+		t.Fatalf("unexpected id column: %+v", id)
+	}
+	name := ct.Columns[1]
+	if !name.Unique || name.NotNull {
+		t.Fatalf("unexpected name column: %+v", name)
+	}
+	if d, ok := name.Default.(*LiteralString); !ok || d.Value != "x" {
+		t.Fatalf("expected DEFAULT 'x', got %T %+v", name.Default, name.Default)
+	}
+	age := ct.Columns[2]
+	if !age.Null {
+		t.Fatalf("expected explicit NULL on age: %+v", age)
+	}
+	if _, ok := age.Check.(*LogicalOp); !ok {
+		t.Fatalf("expected CHECK condition, got %T", age.Check)
+	}
+	owner := ct.Columns[3]
+	if owner.References == nil || owner.References.Table != "users" || len(owner.References.Columns) != 1 || owner.References.Columns[0] != "id" {
+		t.Fatalf("expected REFERENCES users(id), got %+v", owner.References)
+	}
+	if _, ok := ct.Columns[4].Default.(*LiteralNull); !ok {
+		t.Fatalf("expected DEFAULT NULL, got %T", ct.Columns[4].Default)
+	}
+
+	errCases := []string{
+		"CREATE TABLE t (id INT PRIMARY)",
+		"CREATE TABLE t (id INT NOT)",
+		"CREATE TABLE t (id INT NULL NOT NULL)",
+		"CREATE TABLE t (id INT DEFAULT)",
+		"CREATE TABLE t (id INT CHECK id > 0)",
+		"CREATE TABLE t (id INT REFERENCES)",
+		"CREATE TABLE t (id INT REFERENCES u (id)",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseTableConstraints(t *testing.T) {
+	nodes, err := ParseString("CREATE TABLE t (a INT, b INT, PRIMARY KEY (a, b), UNIQUE (b), FOREIGN KEY (a) REFERENCES u(id) ON DELETE CASCADE ON UPDATE SET NULL, CONSTRAINT positive CHECK (a > 0));")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ct := nodes[0].(*CreateTableStmt)
+	if len(ct.Columns) != 2 {
+		t.Fatalf("expected two columns, got %+v", ct.Columns)
+	}
+	if len(ct.Constraints) != 4 {
+		t.Fatalf("expected four table constraints, got %+v", ct.Constraints)
+	}
+	pk := ct.Constraints[0]
+	if pk.Type != "PRIMARY KEY" || pk.Name != "" || len(pk.Columns) != 2 || pk.Columns[1] != "b" {
+		t.Fatalf("unexpected primary key: %+v", pk)
+	}
+	if u := ct.Constraints[1]; u.Type != "UNIQUE" || len(u.Columns) != 1 {
+		t.Fatalf("unexpected unique constraint: %+v", u)
+	}
+	fk := ct.Constraints[2]
+	if fk.Type != "FOREIGN KEY" || fk.References == nil || fk.References.Table != "u" {
+		t.Fatalf("unexpected foreign key: %+v", fk)
+	}
+	if fk.References.OnDelete != "CASCADE" || fk.References.OnUpdate != "SET NULL" {
+		t.Fatalf("unexpected referential actions: %+v", fk.References)
+	}
+	check := ct.Constraints[3]
+	if check.Type != "CHECK" || check.Name != "positive" || check.Check == nil {
+		t.Fatalf("unexpected check constraint: %+v", check)
+	}
+
+	errCases := []string{
+		"CREATE TABLE t (a INT, PRIMARY (a))",
+		"CREATE TABLE t (a INT, UNIQUE a)",
+		"CREATE TABLE t (a INT, FOREIGN KEY (a))",
+		"CREATE TABLE t (a INT, FOREIGN KEY (a) REFERENCES u ON DELETE EXPLODE)",
+		"CREATE TABLE t (a INT, CONSTRAINT CHECK (a > 0))",
+		"CREATE TABLE t (a INT, CONSTRAINT c)",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseDataTypes(t *testing.T) {
+	nodes, err := ParseString("CREATE TABLE t (a integer, b BIGINT, c VARCHAR(255), d DECIMAL(10,2), e numeric(5), f TEXT[][], g DOUBLE PRECISION, h bool, i TIMESTAMP, j BYTEA, k DECIMAL(10,0), l NUMERIC(5,0))")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ct := nodes[0].(*CreateTableStmt)
+	want := []DataType{
+		{Name: "INT"},
+		{Name: "BIGINT"},
+		{Name: "VARCHAR", Length: 255},
+		{Name: "DECIMAL", Precision: 10, Scale: 2, HasScale: true},
+		{Name: "DECIMAL", Precision: 5},
+		{Name: "TEXT", ArrayDims: 2},
+		{Name: "DOUBLE"},
+		{Name: "BOOLEAN"},
+		{Name: "TIMESTAMP"},
+		{Name: "BYTEA"},
+		{Name: "DECIMAL", Precision: 10, HasScale: true},
+		{Name: "DECIMAL", Precision: 5, HasScale: true},
+	}
+	if len(ct.Columns) != len(want) {
+		t.Fatalf("expected %d columns, got %d", len(want), len(ct.Columns))
+	}
+	for i, w := range want {
+		if ct.Columns[i].Type != w {
+			t.Fatalf("column %s: expected type %+v, got %+v", ct.Columns[i].Name, w, ct.Columns[i].Type)
+		}
+	}
+	if s := ct.Columns[3].Type.String(); s != "DECIMAL(10,2)" {
+		t.Fatalf("unexpected DECIMAL string: %s", s)
+	}
+	if s := ct.Columns[10].Type.String(); s != "DECIMAL(10,0)" {
+		t.Fatalf("unexpected zero-scale DECIMAL string: %s", s)
+	}
+	if s := ct.Columns[5].Type.String(); s != "TEXT[][]" {
+		t.Fatalf("unexpected array type string: %s", s)
+	}
+
+	// casts use the same type system
+	nodes, err = ParseString("SELECT CAST(a AS VARCHAR(10)), b::INTEGER FROM t")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	if c, ok := sel.Projections[0].Expr.(*CastExpr); !ok || c.Type != (DataType{Name: "VARCHAR", Length: 10}) {
+		t.Fatalf("expected cast to VARCHAR(10), got %+v", sel.Projections[0].Expr)
+	}
+	if c, ok := sel.Projections[1].Expr.(*CastExpr); !ok || c.Type.Name != "INT" {
+		t.Fatalf("expected cast to INT, got %+v", sel.Projections[1].Expr)
+	}
+
+	errCases := []string{
+		"CREATE TABLE t (a MONEY)",
+		"CREATE TABLE t (a INT(4))",
+		"CREATE TABLE t (a VARCHAR(0))",
+		"CREATE TABLE t (a VARCHAR(10, 2))",
+		"CREATE TABLE t (a DECIMAL(2,5))",
+		"CREATE TABLE t (a DECIMAL(0,0))",
+		"CREATE TABLE t (a VARCHAR(n))",
+		"CREATE TABLE t (a TEXT[)",
+		"SELECT CAST(a AS WIDGET) FROM t",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseCreateTableIfNotExistsAndAsSelect(t *testing.T) {
+	nodes, err := ParseString("CREATE TABLE IF NOT EXISTS users (id INT);")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ct := nodes[0].(*CreateTableStmt)
+	if !ct.IfNotExists || ct.TableName != "users" || len(ct.Columns) != 1 || ct.AsSelect != nil {
+		t.Fatalf("unexpected CREATE TABLE IF NOT EXISTS: %+v", ct)
+	}
+
+	nodes, err = ParseString("CREATE TABLE adults AS SELECT id, name FROM users WHERE age >= 18")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	ct = nodes[0].(*CreateTableStmt)
+	if ct.IfNotExists || ct.TableName != "adults" || len(ct.Columns) != 0 {
+		t.Fatalf("unexpected CREATE TABLE AS: %+v", ct)
+	}
+	if ct.AsSelect == nil || ct.AsSelect.From.Name != "users" || ct.AsSelect.Selection == nil {
+		t.Fatalf("expected source SELECT from users, got %+v", ct.AsSelect)
+	}
+
+	nodes, err = ParseString("CREATE TABLE IF NOT EXISTS ids AS SELECT id FROM a UNION SELECT id FROM b; SELECT * FROM ids")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected two statements, got %d", len(nodes))
+	}
+	ct = nodes[0].(*CreateTableStmt)
+	if !ct.IfNotExists || ct.AsSelect == nil || ct.AsSelect.SetOp == nil {
+		t.Fatalf("expected CTAS with compound source, got %+v", ct)
+	}
+
+	errCases := []string{
+		"CREATE TABLE IF users (id INT)",
+		"CREATE TABLE IF NOT users (id INT)",
+		"CREATE TABLE t AS",
+		"CREATE TABLE t AS INSERT INTO u VALUES (1)",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseAlterTable(t *testing.T) {
+	nodes, err := ParseString("ALTER TABLE users ADD COLUMN age INT NOT NULL DEFAULT 0, DROP COLUMN IF EXISTS legacy, RENAME COLUMN name TO full_name, ALTER COLUMN age TYPE BIGINT, ALTER age SET DEFAULT 1, ALTER COLUMN age DROP NOT NULL, ADD CONSTRAINT uniq_email UNIQUE (email), DROP CONSTRAINT old_check;")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	at, ok := nodes[0].(*AlterTableStmt)
+	if !ok || at.TableName != "users" {
+		t.Fatalf("expected ALTER TABLE users, got %T %+v", nodes[0], nodes[0])
+	}
+	wantTypes := []string{"ADD COLUMN", "DROP COLUMN", "RENAME COLUMN", "ALTER COLUMN TYPE", "SET DEFAULT", "DROP NOT NULL", "ADD CONSTRAINT", "DROP CONSTRAINT"}
+	if len(at.Actions) != len(wantTypes) {
+		t.Fatalf("expected %d actions, got %+v", len(wantTypes), at.Actions)
+	}
+	for i, w := range wantTypes {
+		if at.Actions[i].Type != w {
+			t.Fatalf("action %d: expected %s, got %s", i, w, at.Actions[i].Type)
+		}
+	}
+	if add := at.Actions[0]; add.Column == nil || add.Column.Name != "age" || !add.Column.NotNull || add.Column.Default == nil {
+		t.Fatalf("unexpected ADD COLUMN: %+v", add)
+	}
+	if drop := at.Actions[1]; drop.ColumnName != "legacy" || !drop.IfExists {
+		t.Fatalf("unexpected DROP COLUMN: %+v", drop)
+	}
+	if rn := at.Actions[2]; rn.ColumnName != "name" || rn.NewName != "full_name" {
+		t.Fatalf("unexpected RENAME COLUMN: %+v", rn)
+	}
+	if typ := at.Actions[3]; typ.ColumnName != "age" || typ.DataType.Name != "BIGINT" {
+		t.Fatalf("unexpected ALTER COLUMN TYPE: %+v", typ)
+	}
+	if def, ok := at.Actions[4].Default.(*LiteralInt); !ok || def.Value != 1 {
+		t.Fatalf("unexpected SET DEFAULT: %+v", at.Actions[4])
+	}
+	if c := at.Actions[6].Constraint; c == nil || c.Name != "uniq_email" || c.Type != "UNIQUE" {
+		t.Fatalf("unexpected ADD CONSTRAINT: %+v", at.Actions[6])
+	}
+	if at.Actions[7].ConstraintName != "old_check" || at.Actions[7].IfExists {
+		t.Fatalf("unexpected DROP CONSTRAINT: %+v", at.Actions[7])
+	}
+
+	nodes, err = ParseString("ALTER TABLE users RENAME TO people")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if a := nodes[0].(*AlterTableStmt).Actions[0]; a.Type != "RENAME TO" || a.NewName != "people" {
+		t.Fatalf("unexpected RENAME TO: %+v", a)
+	}
+
+	errCases := []string{
+		"ALTER users ADD COLUMN a INT",
+		"ALTER TABLE users",
+		"ALTER TABLE users ADD COLUMN a",
+		"ALTER TABLE users RENAME COLUMN a b",
+		"ALTER TABLE users ALTER COLUMN a TYPE WIDGET",
+		"ALTER TABLE users ALTER COLUMN a SET NULL",
+		"ALTER TABLE users DROP CONSTRAINT",
+		"ALTER TABLE users TRUNCATE",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseIndexStatements(t *testing.T) {
+	nodes, err := ParseString("CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (email, created DESC, id ASC) WHERE active = 1; CREATE INDEX by_name ON users (name); DROP INDEX IF EXISTS users_email; DROP INDEX by_name")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("expected four statements, got %d", len(nodes))
+	}
+	ci, ok := nodes[0].(*CreateIndexStmt)
+	if !ok {
+		t.Fatalf("expected CreateIndexStmt, got %T", nodes[0])
+	}
+	if !ci.Unique || !ci.IfNotExists || ci.Name != "users_email" || ci.TableName != "users" {
+		t.Fatalf("unexpected CREATE INDEX header: %+v", ci)
+	}
+	if len(ci.Columns) != 3 || ci.Columns[0].Desc || !ci.Columns[1].Desc || ci.Columns[2].Desc {
+		t.Fatalf("unexpected index columns: %+v", ci.Columns)
+	}
+	if _, ok := ci.Where.(*ComparisonOp); !ok {
+		t.Fatalf("expected partial index predicate, got %T", ci.Where)
+	}
+	ci = nodes[1].(*CreateIndexStmt)
+	if ci.Unique || ci.IfNotExists || ci.Where != nil || len(ci.Columns) != 1 {
+		t.Fatalf("unexpected plain CREATE INDEX: %+v", ci)
+	}
+	if di, ok := nodes[2].(*DropIndexStmt); !ok || di.Name != "users_email" || !di.IfExists {
+		t.Fatalf("unexpected DROP INDEX IF EXISTS: %+v", nodes[2])
+	}
+	if di, ok := nodes[3].(*DropIndexStmt); !ok || di.Name != "by_name" || di.IfExists {
+		t.Fatalf("unexpected DROP INDEX: %+v", nodes[3])
+	}
+
+	errCases := []string{
+		"CREATE UNIQUE TABLE t (id INT)",
+		"CREATE INDEX ON users (email)",
+		"CREATE INDEX idx users (email)",
+		"CREATE INDEX idx ON users ()",
+		"CREATE INDEX idx ON users (email",
+		"CREATE INDEX idx ON users (email) WHERE",
+		"DROP INDEX",
+		"DROP TABLE users",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseViews(t *testing.T) {
+	nodes, err := ParseString("CREATE OR REPLACE VIEW adults (id, name) AS SELECT id, name FROM users WHERE age >= 18; CREATE MATERIALIZED VIEW totals AS SELECT * FROM orders; CREATE VIEW v AS SELECT a FROM t UNION SELECT b FROM u; REFRESH MATERIALIZED VIEW totals;")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("expected four statements, got %d", len(nodes))
+	}
+	cv, ok := nodes[0].(*CreateViewStmt)
+	if !ok || !cv.OrReplace || cv.Materialized || cv.Name != "adults" {
+		t.Fatalf("unexpected CREATE OR REPLACE VIEW: %T %+v", nodes[0], nodes[0])
+	}
+	if len(cv.Columns) != 2 || cv.Columns[1] != "name" || cv.Query == nil || cv.Query.Selection == nil {
+		t.Fatalf("unexpected view columns or body: %+v", cv)
+	}
+	cv = nodes[1].(*CreateViewStmt)
+	if cv.OrReplace || !cv.Materialized || cv.Name != "totals" || cv.Columns != nil {
+		t.Fatalf("unexpected CREATE MATERIALIZED VIEW: %+v", cv)
+	}
+	if cv = nodes[2].(*CreateViewStmt); cv.Query.SetOp == nil {
+		t.Fatalf("expected compound view body, got %+v", cv.Query)
+	}
+	if r, ok := nodes[3].(*RefreshMaterializedViewStmt); !ok || r.Name != "totals" {
+		t.Fatalf("unexpected REFRESH MATERIALIZED VIEW: %T %+v", nodes[3], nodes[3])
+	}
+
+	errCases := []string{
+		"CREATE OR VIEW v AS SELECT a FROM t",
+		"CREATE OR REPLACE MATERIALIZED VIEW v AS SELECT a FROM t",
+		"CREATE VIEW v SELECT a FROM t",
+		"CREATE VIEW AS SELECT a FROM t",
+		"CREATE VIEW v AS CREATE TABLE t (id INT)",
+		"REFRESH VIEW v",
+		"REFRESH MATERIALIZED VIEW",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseTransactionControl(t *testing.T) {
+	nodes, err := ParseString("BEGIN; START TRANSACTION ISOLATION LEVEL READ COMMITTED; BEGIN TRANSACTION ISOLATION LEVEL SERIALIZABLE; SAVEPOINT sp1; RELEASE SAVEPOINT sp1; RELEASE sp2; ROLLBACK TO SAVEPOINT sp1; ROLLBACK TO sp2; ROLLBACK WORK; COMMIT TRANSACTION;")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 10 {
+		t.Fatalf("expected ten statements, got %d", len(nodes))
+	}
+	if b, ok := nodes[0].(*BeginStmt); !ok || b.IsolationLevel != "" {
+		t.Fatalf("unexpected BEGIN: %T %+v", nodes[0], nodes[0])
+	}
+	if b, ok := nodes[1].(*BeginStmt); !ok || b.IsolationLevel != "READ COMMITTED" {
+		t.Fatalf("unexpected START TRANSACTION: %T %+v", nodes[1], nodes[1])
+	}
+	if b, ok := nodes[2].(*BeginStmt); !ok || b.IsolationLevel != "SERIALIZABLE" {
+		t.Fatalf("unexpected BEGIN TRANSACTION: %T %+v", nodes[2], nodes[2])
+	}
+	if s, ok := nodes[3].(*SavepointStmt); !ok || s.Name != "sp1" {
+		t.Fatalf("unexpected SAVEPOINT: %T %+v", nodes[3], nodes[3])
+	}
+	if r, ok := nodes[4].(*ReleaseSavepointStmt); !ok || r.Name != "sp1" {
+		t.Fatalf("unexpected RELEASE SAVEPOINT: %T %+v", nodes[4], nodes[4])
+	}
+	if r, ok := nodes[5].(*ReleaseSavepointStmt); !ok || r.Name != "sp2" {
+		t.Fatalf("unexpected RELEASE: %T %+v", nodes[5], nodes[5])
+	}
+	if r, ok := nodes[6].(*RollbackStmt); !ok || r.Savepoint != "sp1" {
+		t.Fatalf("unexpected ROLLBACK TO SAVEPOINT: %T %+v", nodes[6], nodes[6])
+	}
+	if r, ok := nodes[7].(*RollbackStmt); !ok || r.Savepoint != "sp2" {
+		t.Fatalf("unexpected ROLLBACK TO: %T %+v", nodes[7], nodes[7])
+	}
+	if r, ok := nodes[8].(*RollbackStmt); !ok || r.Savepoint != "" {
+		t.Fatalf("unexpected ROLLBACK: %T %+v", nodes[8], nodes[8])
+	}
+	if _, ok := nodes[9].(*CommitStmt); !ok {
+		t.Fatalf("unexpected COMMIT: %T", nodes[9])
+	}
+
+	errCases := []string{
+		"START",
+		"BEGIN ISOLATION SERIALIZABLE",
+		"BEGIN ISOLATION LEVEL READ",
+		"BEGIN ISOLATION LEVEL CHAOS",
+		"SAVEPOINT",
+		"ROLLBACK TO",
+		"RELEASE SAVEPOINT",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	nodes, err := ParseString("SELECT * FROM t WHERE a = $2 AND b = :name AND c = ?; INSERT INTO t VALUES (?, $1, ?)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("expected two statements, got %d", len(nodes))
+	}
+	want := []Param{
+		{Style: ParamDollar, Position: 2},
+		{Style: ParamNamed, Name: "name"},
+		{Style: ParamQuestion, Position: 1},
+	}
+	got := Params(nodes[0])
+	if len(got) != len(want) {
+		t.Fatalf("expected %d params, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Style != want[i].Style || got[i].Position != want[i].Position || got[i].Name != want[i].Name {
+			t.Fatalf("param %d: expected %s, got %s", i, want[i].String(), got[i])
+		}
+	}
+
+	// ? numbering restarts with each statement
+	want = []Param{
+		{Style: ParamQuestion, Position: 1},
+		{Style: ParamDollar, Position: 1},
+		{Style: ParamQuestion, Position: 2},
+	}
+	got = Params(nodes[1])
+	if len(got) != len(want) {
+		t.Fatalf("expected %d params, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Style != want[i].Style || got[i].Position != want[i].Position || got[i].Name != want[i].Name {
+			t.Fatalf("param %d: expected %s, got %s", i, want[i].String(), got[i])
+		}
+	}
+
+	errCases := []string{
+		"SELECT * FROM t WHERE a = $0",
+		"SELECT * FROM t WHERE a = $99999999999999999999",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParsePreparedStatements(t *testing.T) {
+	nodes, err := ParseString("PREPARE q (INT, VARCHAR(10)) AS SELECT * FROM t WHERE id = $1 AND name = $2; EXECUTE q (1, 'x'); EXECUTE r; DEALLOCATE PREPARE q; DEALLOCATE ALL")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 5 {
+		t.Fatalf("expected five statements, got %d", len(nodes))
+	}
+	ps, ok := nodes[0].(*PrepareStmt)
+	if !ok {
+		t.Fatalf("expected *PrepareStmt, got %T", nodes[0])
+	}
+	if ps.Name != "q" || len(ps.ParamTypes) != 2 || ps.ParamTypes[0].Name != "INT" || ps.ParamTypes[1].Length != 10 {
+		t.Fatalf("unexpected PREPARE: %+v", ps)
+	}
+	if _, ok := ps.Statement.(*SelectStmt); !ok {
+		t.Fatalf("expected prepared *SelectStmt, got %T", ps.Statement)
+	}
+	if n := len(Params(ps)); n != 2 {
+		t.Fatalf("expected two params in prepared statement, got %d", n)
+	}
+	ex, ok := nodes[1].(*ExecuteStmt)
+	if !ok || ex.Name != "q" || len(ex.Args) != 2 {
+		t.Fatalf("unexpected EXECUTE: %T %+v", nodes[1], nodes[1])
+	}
+	if ex, ok := nodes[2].(*ExecuteStmt); !ok || ex.Name != "r" || len(ex.Args) != 0 {
+		t.Fatalf("unexpected EXECUTE without args: %T %+v", nodes[2], nodes[2])
+	}
+	if d, ok := nodes[3].(*DeallocateStmt); !ok || d.Name != "q" || d.All {
+		t.Fatalf("unexpected DEALLOCATE: %T %+v", nodes[3], nodes[3])
+	}
+	if d, ok := nodes[4].(*DeallocateStmt); !ok || !d.All {
+		t.Fatalf("unexpected DEALLOCATE ALL: %T %+v", nodes[4], nodes[4])
+	}
+
+	errCases := []string{
+		"PREPARE q SELECT 1",
+		"PREPARE q AS EXECUTE r",
+		"PREPARE q () AS SELECT * FROM t",
+		"EXECUTE",
+		"EXECUTE q (1",
+		"DEALLOCATE",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseOnConflict(t *testing.T) {
+	nodes, err := ParseString("INSERT INTO t (id, v) VALUES (1, 'a') ON CONFLICT (id) DO UPDATE SET v = EXCLUDED.v, n = 2 WHERE t.v != EXCLUDED.v; INSERT INTO t VALUES (1) ON CONFLICT DO NOTHING; INSERT INTO t VALUES (1) ON CONFLICT ON CONSTRAINT t_pkey DO NOTHING")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("expected three statements, got %d", len(nodes))
+	}
+	oc := nodes[0].(*InsertStmt).OnConflict
+	if oc == nil || oc.DoNothing || len(oc.Columns) != 1 || oc.Columns[0] != "id" {
+		t.Fatalf("unexpected ON CONFLICT: %+v", oc)
+	}
+	if len(oc.Set) != 2 || oc.Set[0].Column != "v" || oc.Set[1].Column != "n" {
+		t.Fatalf("unexpected SET: %+v", oc.Set)
+	}
+	if ref, ok := oc.Set[0].Value.(*ColumnRef); !ok || ref.Name != "EXCLUDED.v" {
+		t.Fatalf("expected EXCLUDED.v, got %#v", oc.Set[0].Value)
+	}
+	if _, ok := oc.Where.(*ComparisonOp); !ok {
+		t.Fatalf("expected WHERE comparison, got %T", oc.Where)
+	}
+	if oc := nodes[1].(*InsertStmt).OnConflict; oc == nil || !oc.DoNothing || oc.Columns != nil || oc.Constraint != "" {
+		t.Fatalf("unexpected ON CONFLICT DO NOTHING: %+v", oc)
+	}
+	if oc := nodes[2].(*InsertStmt).OnConflict; oc == nil || !oc.DoNothing || oc.Constraint != "t_pkey" {
+		t.Fatalf("unexpected ON CONFLICT ON CONSTRAINT: %+v", oc)
+	}
+
+	errCases := []string{
+		"INSERT INTO t VALUES (1) ON",
+		"INSERT INTO t VALUES (1) ON CONFLICT",
+		"INSERT INTO t VALUES (1) ON CONFLICT DO UPDATE SET v = 1",
+		"INSERT INTO t VALUES (1) ON CONFLICT (id) DO UPDATE v = 1",
+		"INSERT INTO t VALUES (1) ON CONFLICT (id) DO UPDATE SET v",
+		"INSERT INTO t VALUES (1) ON CONFLICT ON t_pkey DO NOTHING",
+		"INSERT INTO t VALUES (1) ON CONFLICT (id) DO",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseReturning(t *testing.T) {
+	nodes, err := ParseString("INSERT INTO t VALUES (1) ON CONFLICT DO NOTHING RETURNING id, name AS n; UPDATE t SET a = 1, b = 'x' WHERE id = 2 RETURNING *; DELETE FROM t WHERE id = $1 RETURNING id; DELETE FROM t; WITH x AS (SELECT id FROM s) UPDATE t SET a = 1")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 5 {
+		t.Fatalf("expected five statements, got %d", len(nodes))
+	}
+	ins := nodes[0].(*InsertStmt)
+	if ins.OnConflict == nil || len(ins.Returning) != 2 || ins.Returning[0].Column != "id" || ins.Returning[1].Alias != "n" {
+		t.Fatalf("unexpected INSERT RETURNING: %+v", ins.Returning)
+	}
+	upd, ok := nodes[1].(*UpdateStmt)
+	if !ok {
+		t.Fatalf("expected *UpdateStmt, got %T", nodes[1])
+	}
+	if upd.TableName != "t" || len(upd.Set) != 2 || upd.Selection == nil {
+		t.Fatalf("unexpected UPDATE: %+v", upd)
+	}
+	if len(upd.Returning) != 1 || !upd.Returning[0].All {
+		t.Fatalf("expected RETURNING *, got %+v", upd.Returning)
+	}
+	del, ok := nodes[2].(*DeleteStmt)
+	if !ok {
+		t.Fatalf("expected *DeleteStmt, got %T", nodes[2])
+	}
+	if del.TableName != "t" || del.Selection == nil || len(del.Returning) != 1 || del.Returning[0].Column != "id" {
+		t.Fatalf("unexpected DELETE: %+v", del)
+	}
+	if del := nodes[3].(*DeleteStmt); del.Selection != nil || del.Returning != nil {
+		t.Fatalf("unexpected bare DELETE: %+v", del)
+	}
+	if upd := nodes[4].(*UpdateStmt); upd.With == nil || len(upd.With.CTEs) != 1 {
+		t.Fatalf("expected WITH on UPDATE, got %+v", upd.With)
+	}
+
+	errCases := []string{
+		"UPDATE t",
+		"UPDATE t SET",
+		"UPDATE t SET a 1",
+		"DELETE t",
+		"DELETE FROM t WHERE",
+		"DELETE FROM t RETURNING",
+		"INSERT INTO t VALUES (1) RETURNING",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestParseExplain(t *testing.T) {
+	nodes, err := ParseString("EXPLAIN SELECT * FROM t; EXPLAIN ANALYZE VERBOSE DELETE FROM t; EXPLAIN (ANALYZE, FORMAT JSON, VERBOSE FALSE) SELECT a FROM t; EXPLAIN (SELECT a FROM t); EXPLAIN (FORMAT TEXT, ANALYZE OFF) EXECUTE q")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if len(nodes) != 5 {
+		t.Fatalf("expected five statements, got %d", len(nodes))
+	}
+	tests := []struct {
+		analyze, verbose bool
+		format           string
+	}{
+		{false, false, ""},
+		{true, true, ""},
+		{true, false, "JSON"},
+		{false, false, ""},
+		{false, false, "TEXT"},
+	}
+	for i, tt := range tests {
+		es, ok := nodes[i].(*ExplainStmt)
+		if !ok {
+			t.Fatalf("statement %d: expected *ExplainStmt, got %T", i, nodes[i])
+		}
+		if es.Analyze != tt.analyze || es.Verbose != tt.verbose || es.Format != tt.format {
+			t.Fatalf("statement %d: unexpected options %+v", i, es)
+		}
+	}
+	if _, ok := nodes[1].(*ExplainStmt).Statement.(*DeleteStmt); !ok {
+		t.Fatalf("expected explained *DeleteStmt, got %T", nodes[1].(*ExplainStmt).Statement)
+	}
+	if _, ok := nodes[3].(*ExplainStmt).Statement.(*SelectStmt); !ok {
+		t.Fatalf("expected explained parenthesized *SelectStmt, got %T", nodes[3].(*ExplainStmt).Statement)
+	}
+	if _, ok := nodes[4].(*ExplainStmt).Statement.(*ExecuteStmt); !ok {
+		t.Fatalf("expected explained *ExecuteStmt, got %T", nodes[4].(*ExplainStmt).Statement)
+	}
+
+	errCases := []string{
+		"EXPLAIN",
+		"EXPLAIN ANALYZE",
+		"EXPLAIN EXPLAIN SELECT * FROM t",
+		"EXPLAIN (FORMAT XML) SELECT * FROM t",
+		"EXPLAIN (FORMAT) SELECT * FROM t",
+		"EXPLAIN (ANALYZE SELECT * FROM t",
+		"EXPLAIN (VERBOSE, COSTS) SELECT * FROM t",
+	}
+	for _, q := range errCases {
+		if _, err := ParseString(q); err == nil {
+			t.Fatalf("expected parse error for %q but got none", q)
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	nodes, err := ParseString("SELECT a,\n  b\nFROM t\nWHERE x = 1 AND y IN (SELECT z FROM u);\nINSERT INTO t VALUES ($1)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	ins := nodes[1].(*InsertStmt)
+	in := sel.Selection.(*LogicalOp).Right.(*InExpr)
+	tests := []struct {
+		name string
+		node Node
+		want Pos
+	}{
+		{"select", sel, Pos{Offset: 0, Line: 1, Column: 1}},
+		{"where", sel.Selection, Pos{Offset: 27, Line: 4, Column: 7}},
+		{"in", in, Pos{Offset: 37, Line: 4, Column: 17}},
+		{"subquery", in.Subquery, Pos{Offset: 43, Line: 4, Column: 23}},
+		{"insert", ins, Pos{Offset: 61, Line: 5, Column: 1}},
+		{"param", ins.Values[0], Pos{Offset: 83, Line: 5, Column: 23}},
+	}
+	for _, tt := range tests {
+		if got := tt.node.Pos(); got != tt.want {
+			t.Fatalf("%s: expected position %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+
+	// every node produced by the parser knows where it starts
+	nodes, err = ParseString("WITH w AS (SELECT 1 FROM s) SELECT a, count(*) OVER (PARTITION BY b), CASE WHEN a > 1 THEN 'x' ELSE NULL END, CAST(c AS INT), d::TEXT FROM t WHERE NOT EXISTS (SELECT 1 FROM u) AND e BETWEEN 1 AND 2 OR f NOT LIKE 'x' ESCAPE '!' UNION SELECT (SELECT 1 FROM v) FROM t; PREPARE q AS UPDATE t SET a = ? WHERE b IN (1, 2) RETURNING a; EXPLAIN DELETE FROM t; EXECUTE q (1)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	for _, n := range nodes {
+		Inspect(n, func(sub Node) bool {
+			if !sub.Pos().IsValid() {
+				t.Fatalf("%T has no position in %s", sub, n)
+			}
+			return true
+		})
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	nodes, err := ParseString("SELECT a FROM t WHERE a = 1 AND b IN (1, 'x'); COMMIT; EXECUTE q (1, $1)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	if got, want := sel.Selection.String(), "(col:a = int:1 AND col:b IN (int:1, str:'x'))"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if got, want := sel.String(), "SELECT\n  Projections:\n    a\n  FROM: t\n  WHERE:\n    Logical: AND\n      Comparison: =\n        Column: a\n        Integer: 1\n      In:\n        Column: b\n        Integer: 1\n        String: 'x'"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if got := nodes[1].String(); got != "COMMIT" {
+		t.Fatalf("expected COMMIT, got %q", got)
+	}
+	if got, want := nodes[2].String(), "EXECUTE q (int:1, param:$1)"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+// traceVisitor records Enter and Leave calls as +Type and -Type
+type traceVisitor struct {
+	trace []string
+	skip  string // node type whose children are skipped
+}
+
+func (v *traceVisitor) Enter(n Node) bool {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", n), "*parser.")
+	v.trace = append(v.trace, "+"+name)
+	return name != v.skip
+}
+
+func (v *traceVisitor) Leave(n Node) {
+	v.trace = append(v.trace, "-"+strings.TrimPrefix(fmt.Sprintf("%T", n), "*parser."))
+}
+
+func TestWalk(t *testing.T) {
+	nodes, err := ParseString("SELECT a FROM t WHERE a = 1 AND EXISTS (SELECT b FROM u)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	v := &traceVisitor{}
+	Walk(nodes[0], v)
+	want := "+SelectStmt +LogicalOp +ComparisonOp +ColumnRef -ColumnRef +LiteralInt -LiteralInt -ComparisonOp +ExistsExpr +SelectStmt -SelectStmt -ExistsExpr -LogicalOp -SelectStmt"
+	if got := strings.Join(v.trace, " "); got != want {
+		t.Fatalf("unexpected walk order:\n got %s\nwant %s", got, want)
+	}
+
+	// returning false from Enter skips the children and the matching Leave
+	v = &traceVisitor{skip: "ComparisonOp"}
+	Walk(nodes[0], v)
+	want = "+SelectStmt +LogicalOp +ComparisonOp +ExistsExpr +SelectStmt -SelectStmt -ExistsExpr -LogicalOp -SelectStmt"
+	if got := strings.Join(v.trace, " "); got != want {
+		t.Fatalf("unexpected walk order with skip:\n got %s\nwant %s", got, want)
+	}
+
+	// every node type is reachable from the statements that hold it
+	nodes, err = ParseString(`WITH w AS (SELECT 1 FROM s) SELECT count(*) OVER (PARTITION BY b ORDER BY c ROWS BETWEEN 1 PRECEDING AND CURRENT ROW), CASE a WHEN 1 THEN 'x' ELSE NULL END, CAST(c AS INT), (SELECT 1 FROM v) FROM (SELECT a FROM t) AS d WHERE a IN (1, $1) AND b NOT BETWEEN 1 AND 2 OR c LIKE 'x' ESCAPE '!' ORDER BY a;
+		INSERT INTO t VALUES (?) ON CONFLICT (id) DO UPDATE SET a = 1 WHERE b = 2 RETURNING a;
+		PREPARE q AS UPDATE t SET a = 1 WHERE b = 2;
+		EXPLAIN DELETE FROM t WHERE a = 1;
+		EXECUTE q (1);
+		CREATE TABLE t (a INT DEFAULT 1 CHECK (a > 0), CHECK (a < 10));
+		CREATE TABLE c AS SELECT * FROM t;
+		ALTER TABLE t ALTER COLUMN a SET DEFAULT 2, ADD COLUMN b INT DEFAULT 3;
+		CREATE INDEX i ON t (a) WHERE a > 1;
+		DROP INDEX i;
+		CREATE VIEW v AS SELECT * FROM t;
+		REFRESH MATERIALIZED VIEW v;
+		BEGIN; SAVEPOINT s; RELEASE s; ROLLBACK; COMMIT; DEALLOCATE q`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, n := range nodes {
+		Inspect(n, func(n Node) bool {
+			seen[strings.TrimPrefix(fmt.Sprintf("%T", n), "*parser.")] = true
+			return true
+		})
+	}
+	for _, typ := range []string{
+		"SelectStmt", "InsertStmt", "UpdateStmt", "DeleteStmt", "CreateTableStmt", "CreateIndexStmt",
+		"DropIndexStmt", "CreateViewStmt", "RefreshMaterializedViewStmt", "BeginStmt", "CommitStmt",
+		"RollbackStmt", "SavepointStmt", "ReleaseSavepointStmt", "PrepareStmt", "ExecuteStmt",
+		"DeallocateStmt", "ExplainStmt", "AlterTableStmt",
+		"ColumnRef", "LiteralInt", "LiteralString", "LiteralNull", "LogicalOp", "ComparisonOp",
+		"SubqueryExpr", "InExpr", "BetweenExpr", "LikeExpr", "CaseExpr", "FuncCall", "Param", "CastExpr",
+	} {
+		if !seen[typ] {
+			t.Fatalf("walk never reached a %s", typ)
+		}
+	}
+	if got := len(Params(nodes[1])); got != 1 {
+		t.Fatalf("expected one param in INSERT, got %d", got)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	nodes, err := ParseString("SELECT a FROM t WHERE a = $1 AND b IN (SELECT c FROM u WHERE d = $2)")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	// inline parameter values
+	out := Rewrite(nodes[0], func(n Node) Node {
+		if p, ok := n.(*Param); ok {
+			return &LiteralInt{Value: uint64(p.Position * 10)}
+		}
+		return n
+	})
+	if out != nodes[0] {
+		t.Fatalf("expected the root to be kept")
+	}
+	if got := len(Params(out)); got != 0 {
+		t.Fatalf("expected all params to be replaced, %d left", got)
+	}
+	sel := out.(*SelectStmt)
+	if got, want := sel.Selection.String(), "(col:a = int:10 AND col:b IN (subquery))"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	sub := sel.Selection.(*LogicalOp).Right.(*InExpr).Subquery
+	if got, want := sub.Selection.String(), "col:d = int:20"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	// statements can be replaced too
+	nodes, err = ParseString("EXPLAIN DELETE FROM t")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	Rewrite(nodes[0], func(n Node) Node {
+		if del, ok := n.(*DeleteStmt); ok {
+			return &UpdateStmt{TableName: del.TableName, Set: []Assignment{{Column: "deleted", Value: &LiteralInt{Value: 1}}}}
+		}
+		return n
+	})
+	if _, ok := nodes[0].(*ExplainStmt).Statement.(*UpdateStmt); !ok {
+		t.Fatalf("expected explained statement to be replaced, got %T", nodes[0].(*ExplainStmt).Statement)
+	}
+
+	// a replacement that does not fit its slot panics
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic when replacing an expression with a statement")
+		}
+	}()
+	Rewrite(nodes[0], func(n Node) Node {
+		if _, ok := n.(*LiteralInt); ok {
+			return &CommitStmt{}
+		}
+		return n
+	})
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"select a, b as c from t where a = 1", "SELECT a, b AS c FROM t WHERE a = 1"},
+		{"SELECT * FROM t WHERE name = 'it''s'", "SELECT * FROM t WHERE name = 'it''s'"},
+		{"SELECT a FROM t WHERE (a = 1 OR b = 2) AND c = 3", "SELECT a FROM t WHERE (a = 1 OR b = 2) AND c = 3"},
+		{"SELECT a FROM t WHERE a = 1 AND (b = 2 AND c = 3)", "SELECT a FROM t WHERE a = 1 AND (b = 2 AND c = 3)"},
+		{"SELECT a FROM t WHERE ((a = 1) AND b = 2)", "SELECT a FROM t WHERE a = 1 AND b = 2"},
+		{"SELECT a FROM t UNION (SELECT a FROM u INTERSECT SELECT a FROM v)", "SELECT a FROM t UNION SELECT a FROM u INTERSECT SELECT a FROM v"},
+		{"SELECT a FROM t EXCEPT (SELECT a FROM u UNION SELECT a FROM v)", "SELECT a FROM t EXCEPT (SELECT a FROM u UNION SELECT a FROM v)"},
+		{"(SELECT a FROM t ORDER BY a LIMIT 1) UNION ALL SELECT a FROM u", "(SELECT a FROM t ORDER BY a LIMIT 1) UNION ALL SELECT a FROM u"},
+		{"SELECT count(*) OVER w, sum(a) OVER (PARTITION BY b ORDER BY c DESC ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) FROM t WINDOW w AS (ORDER BY a)",
+			"SELECT count(*) OVER w, sum(a) OVER (PARTITION BY b ORDER BY c DESC ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) FROM t WINDOW w AS (ORDER BY a)"},
+		{"SELECT a::varchar(10) FROM t", "SELECT CAST(a AS VARCHAR(10)) FROM t"},
+		{"insert into t (a, b) values (1, 'x') on conflict (a) do update set b = 'y' returning *",
+			"INSERT INTO t (a, b) VALUES (1, 'x') ON CONFLICT (a) DO UPDATE SET b = 'y' RETURNING *"},
+		{"explain (format json, analyze) delete from t where a = $1", "EXPLAIN (ANALYZE, FORMAT JSON) DELETE FROM t WHERE a = $1"},
+		{"create table t (id int primary key, n text not null default 'x', check (id > 0))",
+			"CREATE TABLE t (id INT PRIMARY KEY, n TEXT NOT NULL DEFAULT 'x', CHECK (id > 0))"},
+	}
+	for _, tc := range cases {
+		nodes, err := ParseString(tc.in)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", tc.in, err)
+		}
+		if got := Format(nodes[0]); got != tc.want {
+			t.Fatalf("Format(%q):\n got %s\nwant %s", tc.in, got, tc.want)
+		}
+	}
+
+	nodes, err := ParseString("SELECT a FROM t WHERE a = 1 OR b LIKE 'x%'")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got, want := Format(nodes[0].(*SelectStmt).Selection), "a = 1 OR b LIKE 'x%'"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+// stripPositions clears the position of every node so trees parsed from
+// different text can be compared structurally
+func stripPositions(n Node) {
+	Inspect(n, func(n Node) bool {
+		n.setPos(Pos{})
+		n.setEnd(Pos{})
+		return true
+	})
+}
+
+// roundTripCorpus covers every statement and expression form the parser
+// accepts; it is shared by the Format and JSON round-trip tests
+var roundTripCorpus = []string{
+	"SELECT * FROM users",
+	"SELECT DISTINCT_ID, name AS n FROM users AS u WHERE age >= 18 AND name != 'bob' ORDER BY age DESC, name LIMIT 10",
+	"SELECT a FROM t WHERE a = 1 OR b = 2 AND c = 3",
+	"SELECT a FROM t WHERE a = 1 OR (b = 2 OR c = 3)",
+	"SELECT a FROM t WHERE (a = 1 OR b = 'it''s') AND NOT EXISTS (SELECT 1 FROM u WHERE u.a = t.a)",
+	"SELECT a FROM t WHERE a IN (1, 2, NULL) AND b NOT IN (SELECT b FROM u) AND c BETWEEN 1 AND 10",
+	"SELECT a FROM t WHERE a NOT LIKE 'x!%' ESCAPE '!' AND b ILIKE '%y'",
+	"SELECT CASE WHEN a > 1 THEN 'big' WHEN a = 1 THEN 'one' ELSE 'small' END, CASE a WHEN 1 THEN 2 END FROM t",
+	"SELECT CAST(a AS NUMERIC(10, 2)), b::INT[], c::TIMESTAMP FROM t",
+	"CREATE TABLE t (a DECIMAL(10,0), b NUMERIC(5))",
+	"SELECT (SELECT max(a) FROM u) AS m, count(*) FROM t",
+	"SELECT a FROM (SELECT a FROM t WHERE a > 1) AS s",
+	"SELECT rank() OVER (PARTITION BY a ORDER BY b RANGE UNBOUNDED PRECEDING), sum(b) OVER w FROM t WINDOW w AS (PARTITION BY a)",
+	"SELECT lag(a) OVER (w ORDER BY b ROWS BETWEEN CURRENT ROW AND 3 FOLLOWING) FROM t WINDOW w AS (PARTITION BY c)",
+	"WITH RECURSIVE r (n) AS (SELECT 1 FROM one UNION ALL SELECT n FROM r WHERE n < 10) SELECT n FROM r",
+	"SELECT a FROM t UNION SELECT a FROM u EXCEPT SELECT a FROM v",
+	"SELECT a FROM t UNION (SELECT a FROM u EXCEPT SELECT a FROM v)",
+	"SELECT a FROM t INTERSECT SELECT a FROM u UNION ALL SELECT a FROM v ORDER BY a LIMIT 5",
+	"(SELECT a FROM t INTERSECT SELECT a FROM u) INTERSECT (SELECT a FROM v INTERSECT SELECT a FROM w)",
+	"(WITH c AS (SELECT a FROM t) SELECT a FROM c) UNION SELECT a FROM u",
+	"INSERT INTO t VALUES (1, 'x', NULL)",
+	"WITH s AS (SELECT a FROM u) INSERT INTO t (a, b) VALUES ($1, $2) ON CONFLICT ON CONSTRAINT t_pkey DO NOTHING RETURNING a, b AS c",
+	"INSERT INTO t (a) VALUES (?) ON CONFLICT (a) DO UPDATE SET a = 2, b = 'y' WHERE b = 1",
+	"UPDATE t SET a = 1, b = :name WHERE c = 2 RETURNING *",
+	"DELETE FROM t WHERE a IN (SELECT a FROM u) RETURNING a",
+	"CREATE TABLE IF NOT EXISTS t (id BIGINT PRIMARY KEY, email VARCHAR(255) NOT NULL UNIQUE, parent INT NULL REFERENCES t (id) ON DELETE CASCADE ON UPDATE SET NULL, n INT DEFAULT 0 CHECK (n >= 0 AND n < 100), CONSTRAINT u UNIQUE (email, n), FOREIGN KEY (parent) REFERENCES p (id))",
+	"CREATE TABLE c AS SELECT a FROM t WHERE a > 1",
+	"ALTER TABLE t ADD COLUMN b TEXT DEFAULT 'x', DROP COLUMN IF EXISTS c, RENAME COLUMN d TO e, RENAME TO u",
+	"ALTER TABLE t ALTER COLUMN a TYPE BIGINT, ALTER COLUMN a SET DEFAULT 1, ALTER COLUMN a DROP DEFAULT, ALTER COLUMN b SET NOT NULL, ALTER COLUMN c DROP NOT NULL",
+	"ALTER TABLE t ADD CONSTRAINT ck CHECK (a > 0), ADD PRIMARY KEY (a), DROP CONSTRAINT IF EXISTS old",
+	"CREATE UNIQUE INDEX IF NOT EXISTS i ON t (a, b DESC) WHERE a > 1",
+	"DROP INDEX IF EXISTS i",
+	"CREATE OR REPLACE VIEW v (a, b) AS SELECT a, b FROM t",
+	"CREATE MATERIALIZED VIEW m AS SELECT a FROM t",
+	"REFRESH MATERIALIZED VIEW v",
+	"BEGIN ISOLATION LEVEL SERIALIZABLE",
+	"BEGIN; SAVEPOINT s; ROLLBACK TO SAVEPOINT s; RELEASE SAVEPOINT s; ROLLBACK; COMMIT",
+	"PREPARE q (INT, TEXT) AS SELECT a FROM t WHERE a = $1 AND b = $2",
+	"EXECUTE q (1, 'x')",
+	"EXECUTE q",
+	"DEALLOCATE q",
+	"DEALLOCATE ALL",
+	"EXPLAIN SELECT a FROM t",
+	"EXPLAIN ANALYZE VERBOSE UPDATE t SET a = 1",
+	"EXPLAIN (VERBOSE, FORMAT TEXT) SELECT a FROM t",
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, sql := range roundTripCorpus {
+		nodes, err := ParseString(sql)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", sql, err)
+		}
+		for _, n := range nodes {
+			out := Format(n)
+			again, err := ParseString(out)
+			if err != nil {
+				t.Fatalf("reparse of %q failed: %v\nformatted: %s", sql, err, out)
+			}
+			if len(again) != 1 {
+				t.Fatalf("expected one statement from %q, got %d", out, len(again))
+			}
+			stripPositions(n)
+			stripPositions(again[0])
+			if !reflect.DeepEqual(n, again[0]) {
+				t.Fatalf("round trip changed the tree for %q\nformatted: %s\nbefore:\n%s\nafter:\n%s", sql, out, n, again[0])
+			}
+			if twice := Format(again[0]); twice != out {
+				t.Fatalf("Format is not stable for %q:\n first %s\nsecond %s", sql, out, twice)
+			}
+			pretty := Pretty(n)
+			again, err = ParseString(pretty)
+			if err != nil {
+				t.Fatalf("reparse of pretty %q failed: %v\nformatted:\n%s", sql, err, pretty)
+			}
+			stripPositions(again[0])
+			if !reflect.DeepEqual(n, again[0]) {
+				t.Fatalf("Pretty changed the tree for %q\nformatted:\n%s", sql, pretty)
+			}
+		}
+	}
+}
+
+func TestPretty(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"select a from t where a = 1", "SELECT a\nFROM t\nWHERE a = 1"},
+		{"select id, first_name, last_name, email, phone_number, created_at, updated_at, deleted_at from users",
+			"SELECT\n  id,\n  first_name,\n  last_name,\n  email,\n  phone_number,\n  created_at,\n  updated_at,\n  deleted_at\nFROM users"},
+		{"select a from t where first_name = 'alice' and last_name = 'smith' and (age > 30 or age < 20) and b = 1",
+			"SELECT a\nFROM t\nWHERE first_name = 'alice'\n  AND last_name = 'smith'\n  AND (age > 30 OR age < 20)\n  AND b = 1"},
+		{"with r as (select a from t) select a from r union all (select a from u order by a limit 1)",
+			"WITH r AS (\n  SELECT a\n  FROM t\n)\nSELECT a\nFROM r\nUNION ALL\n(\n  SELECT a\n  FROM u\n  ORDER BY a\n  LIMIT 1\n)"},
+		{"update t set a = 1 where b = 2 returning a", "UPDATE t\nSET a = 1\nWHERE b = 2\nRETURNING a"},
+		{"create table t (id int primary key, name text not null)", "CREATE TABLE t (\n  id INT PRIMARY KEY,\n  name TEXT NOT NULL\n)"},
+		{"explain analyze delete from t where a = 1", "EXPLAIN ANALYZE\nDELETE FROM t\nWHERE a = 1"},
+		{"commit", "COMMIT"},
+		{"insert into t values ('line\nbreak')", "INSERT INTO t VALUES ('line\nbreak')"},
+	}
+	for _, tc := range cases {
+		nodes, err := ParseString(tc.in)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", tc.in, err)
+		}
+		if got := Pretty(nodes[0]); got != tc.want {
+			t.Fatalf("Pretty(%q):\n got:\n%s\nwant:\n%s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFormatScript(t *testing.T) {
+	src := `-- users report
+
+/* active only */ select id from users where active = 1; -- by id
+insert into log values (1)
+;select a, -- inner
+  b from t
+
+
+-- trailing notes
+`
+	want := `-- users report
+
+/* active only */
+SELECT id
+FROM users
+WHERE active = 1; -- by id
+INSERT INTO log
+VALUES (1);
+-- inner
+SELECT a, b
+FROM t;
+
+-- trailing notes
+`
+	got, err := FormatScript(src)
+	if err != nil {
+		t.Fatalf("format failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", got, want)
+	}
+	if again, err := FormatScript(got); err != nil || again != got {
+		t.Fatalf("FormatScript is not idempotent (err %v):\n%s", err, again)
+	}
+
+	if _, err := FormatScript("SELECT FROM t"); err == nil {
+		t.Fatalf("expected parse error")
+	}
+	// a comment moved out of a statement keeps the blank line before it
+	got, err = FormatScript("SELECT 1 FROM t;\n\nSELECT a, -- inner\n b FROM t;")
+	if want := "SELECT 1\nFROM t;\n\n-- inner\nSELECT a, b\nFROM t;\n"; err != nil || got != want {
+		t.Fatalf("unexpected output %q (err %v), want %q", got, err, want)
+	}
+	if got, err := FormatScript("-- nothing\n"); err != nil || got != "-- nothing\n" {
+		t.Fatalf("expected comment-only script to be kept, got %q (err %v)", got, err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, sql := range roundTripCorpus {
+		stmts, err := ParseString(sql)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", sql, err)
+		}
+		data, err := EncodeStatementsJSON(stmts)
+		if err != nil {
+			t.Fatalf("encode %q failed: %v", sql, err)
+		}
+		got, err := DecodeStatementsJSON(data)
+		if err != nil {
+			t.Fatalf("decode %q failed: %v\njson: %s", sql, err, data)
+		}
+		if !reflect.DeepEqual(got, stmts) {
+			t.Fatalf("JSON round trip changed the tree for %q\njson: %s", sql, data)
+		}
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	nodes, err := ParseString("SELECT a FROM t WHERE a::INT = $1 LIMIT 5")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := nodes[0].(*SelectStmt)
+	data, err := EncodeJSON(sel.Selection)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	want := `{"type":"ComparisonOp","pos":{"offset":22,"line":1,"column":23},"end":{"offset":33,"line":1,"column":34},` +
+		`"left":{"type":"CastExpr","pos":{"offset":22,"line":1,"column":23},"end":{"offset":28,"line":1,"column":29},` +
+		`"expr":{"type":"ColumnRef","pos":{"offset":22,"line":1,"column":23},"end":{"offset":23,"line":1,"column":24},"name":"a"},` +
+		`"data_type":{"name":"INT","length":0,"precision":0,"scale":0,"has_scale":false,"array_dims":0}},` +
+		`"op":"=",` +
+		`"right":{"type":"Param","pos":{"offset":31,"line":1,"column":32},"end":{"offset":33,"line":1,"column":34},"style":"$","position":1,"name":""}}`
+	if string(data) != want {
+		t.Fatalf("unexpected JSON:\n got %s\nwant %s", data, want)
+	}
+
+	// constructed nodes have no position
+	data, err = EncodeJSON(&SelectStmt{Projections: []ProjectionItem{{All: true}}, From: TableRef{Name: "t"}, Limit: sel.Limit})
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	want = `{"type":"SelectStmt","pos":null,"end":null,"with":null,"projections":[{"all":true,"column":"","expr":null,"alias":""}],` +
+		`"from":{"name":"t","subquery":null,"alias":""},"selection":null,"windows":null,"set_op":null,"order_by":null,"limit":5}`
+	if string(data) != want {
+		t.Fatalf("unexpected JSON:\n got %s\nwant %s", data, want)
+	}
+	n, err := DecodeJSON(data)
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if got := Format(n); got != "SELECT * FROM t LIMIT 5" {
+		t.Fatalf("unexpected decoded query %q", got)
+	}
+
+	// only nodes have a "type" key, and operators are not HTML-escaped
+	nodes, err = ParseString("ALTER TABLE t ADD CONSTRAINT ck CHECK (a > 0 AND b != 'x&y')")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	data, err = EncodeJSON(nodes[0])
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	for _, want := range []string{`"action":"ADD CONSTRAINT"`, `"name":"ck","constraint_type":"CHECK"`, `"op":">"`, `"value":"x&y"`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected %s in %s", want, data)
+		}
+	}
+	if got := strings.Count(string(data), `"type":`); got != 8 {
+		t.Fatalf("expected 8 \"type\" keys, got %d in %s", got, data)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	cases := []struct {
+		in  string
+		err string
+	}{
+		{`{"type":"Nope"}`, `unknown node type "Nope"`},
+		{`{"name":"a"}`, `unknown node type ""`},
+		{`{"type":"ColumnRef","nme":"a"}`, `unknown field "nme" in ColumnRef`},
+		{`{"type":"LiteralInt","value":"1"}`, `LiteralInt.value: expected a number, got a string`},
+		{`{"type":"LiteralInt","value":-1}`, `LiteralInt.value: invalid unsigned integer -1`},
+		{`{"type":"SubqueryExpr","select":{"type":"ColumnRef"}}`, `SubqueryExpr.select: *parser.ColumnRef cannot be used as *parser.SelectStmt`},
+		{`{"type":"LogicalOp","left":{"type":"CommitStmt"}}`, `LogicalOp.left: *parser.CommitStmt cannot be used as parser.Expr`},
+		{`{"type":"ExecuteStmt","args":{}}`, `ExecuteStmt.args: expected an array, got an object`},
+		{`[1`, `unexpected EOF`},
+	}
+	for _, tc := range cases {
+		_, err := DecodeJSON([]byte(tc.in))
+		if err == nil || err.Error() != tc.err {
+			t.Fatalf("DecodeJSON(%s): expected error %q, got %v", tc.in, tc.err, err)
+		}
+	}
+	if _, err := DecodeStatementsJSON([]byte(`[{"type":"ColumnRef","name":"a"}]`)); err == nil || err.Error() != "statement 0: *parser.ColumnRef is not a statement" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	nodes, err := ParseString(`SELECT a AS x FROM t WHERE b = 'say "hi"' LIMIT 3; COMMIT`)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	want := `digraph AST {
+	node [fontname="Helvetica"];
+	edge [fontname="Helvetica", fontsize=10];
+	n0 [label="SelectStmt\nlimit: 3", shape=box];
+	n1 [label="ProjectionItem\ncolumn: a\nalias: x", shape=box, style=rounded];
+	n0 -> n1 [label="projections[0]"];
+	n2 [label="TableRef\nname: t", shape=box, style=rounded];
+	n0 -> n2 [label="from"];
+	n3 [label="ComparisonOp\nop: =", shape=ellipse];
+	n4 [label="ColumnRef\nname: b", shape=ellipse];
+	n3 -> n4 [label="left"];
+	n5 [label="LiteralString\nvalue: say \"hi\"", shape=ellipse];
+	n3 -> n5 [label="right"];
+	n0 -> n3 [label="selection"];
+	n6 [label="CommitStmt", shape=box];
+}
+`
+	if got := ToDOT(nodes); got != want {
+		t.Fatalf("unexpected DOT:\n%s\nwant:\n%s", got, want)
+	}
+
+	// every statement form renders, with one edge per non-root node
+	for _, sql := range roundTripCorpus {
+		stmts, err := ParseString(sql)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", sql, err)
+		}
+		out := ToDOT(stmts)
+		nodeCount := strings.Count(out, "[label=") - strings.Count(out, " -> ")
+		if edges := strings.Count(out, " -> "); edges != nodeCount-len(stmts) {
+			t.Fatalf("expected %d edges for %q, got %d:\n%s", nodeCount-len(stmts), sql, edges, out)
+		}
+	}
+
+	nodes, err = ParseString("CREATE TABLE t (a VARCHAR(10)[] NOT NULL, PRIMARY KEY (a, b))")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	out := ToDOT(nodes)
+	for _, want := range []string{`"ColumnDef\nname: a\ndata_type: VARCHAR(10)[]\nnot_null: true"`, `"TableConstraint\nconstraint_type: PRIMARY KEY\ncolumns: a, b"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in:\n%s", want, out)
+		}
+	}
+
+	nodes, err = ParseString("SELECT a FROM t WHERE a = :id AND b = $2 AND c = 0")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	out = ToDOT(nodes)
+	for _, want := range []string{`"Param\nstyle: :\nname: id"`, `"Param\nstyle: $\nposition: 2"`, `"LiteralInt\nvalue: 0"`} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestParseCST(t *testing.T) {
+	scripts := append([]string{
+		"-- report\nSELECT a, /* why */ f(b)\n  FROM t\t WHERE (a = 1 OR b LIKE 'x' ESCAPE '!') ORDER BY a LIMIT 2; COMMIT -- done\n",
+		"select CASE WHEN a > 0 THEN 1 END::int, count(*) OVER w FROM t WINDOW w AS (ORDER BY a)",
+	}, roundTripCorpus...)
+	for _, src := range scripts {
+		cst, err := ParseCST(src)
+		if err != nil {
+			t.Fatalf("parse %q failed: %v", src, err)
+		}
+		if got := cst.Root.Text(); got != src {
+			t.Fatalf("CST is not lossless:\n got %q\nwant %q", got, src)
+		}
+		// leaves tile the source without gaps
+		offset := 0
+		for _, leaf := range cst.Root.Tokens(true) {
+			if leaf.Span.Start != offset {
+				t.Fatalf("gap before %q at %d in %q", leaf.Text(), offset, src)
+			}
+			offset = leaf.Span.End
+		}
+		for _, stmt := range cst.Statements {
+			Inspect(stmt, func(n Node) bool {
+				cn := cst.Lookup(n)
+				if cn == nil {
+					t.Fatalf("%T at %s has no CST node in %q", n, n.Pos(), src)
+				}
+				if cn.Node != n {
+					t.Fatalf("CST node for %T links to %T", n, cn.Node)
+				}
+				if got, want := cn.Text(), src[n.Pos().Offset:n.End().Offset]; got != want {
+					t.Fatalf("CST text for %T is %q, want %q", n, got, want)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestCSTEditing(t *testing.T) {
+	src := "SELECT a,  b -- keep me\nFROM t WHERE a = 1 AND b = 'x'"
+	cst, err := ParseCST(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := cst.Statements[0].(*SelectStmt)
+	right := sel.Selection.(*LogicalOp).Right
+	if got := cst.NodeAt(strings.Index(src, "'x'") + 1); got != right.(*ComparisonOp).Right {
+		t.Fatalf("NodeAt returned %v", got)
+	}
+	if got := cst.NodeAt(strings.Index(src, "AND")); got != sel.Selection {
+		t.Fatalf("NodeAt on AND returned %v", got)
+	}
+	if got := cst.NodeAt(len(src) + 5); got != nil {
+		t.Fatalf("expected no node past the end, got %v", got)
+	}
+
+	out, err := cst.Replace(right, "b IN ('x', 'y')")
+	if err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if want := "SELECT a,  b -- keep me\nFROM t WHERE a = 1 AND b IN ('x', 'y')"; out != want {
+		t.Fatalf("unexpected edit:\n got %q\nwant %q", out, want)
+	}
+	if _, err := cst.Replace(&ColumnRef{Name: "z"}, "z"); err == nil {
+		t.Fatalf("expected error replacing a node outside the tree")
+	}
+
+	cn := cst.Lookup(sel.Selection)
+	var words []string
+	for _, tok := range cn.Tokens(false) {
+		words = append(words, tok.Text())
+	}
+	if got := strings.Join(words, " "); got != "a = 1 AND b = 'x'" {
+		t.Fatalf("unexpected tokens %q", got)
+	}
+	if cn.Parent != cst.Lookup(sel) || cst.Lookup(sel).Parent != cst.Root {
+		t.Fatalf("unexpected CST parents")
+	}
+	// the comment and the whitespace around it belong to the statement
+	var trivia []string
+	for _, c := range cst.Lookup(sel).Children {
+		if c.IsTrivia() {
+			trivia = append(trivia, c.Text())
+		}
+	}
+	if want := []string{" ", "  ", " ", "-- keep me", "\n", " ", " ", " "}; !reflect.DeepEqual(trivia, want) {
+		t.Fatalf("unexpected statement trivia %q", trivia)
+	}
+}
+
+func TestCSTParenthesizedOperand(t *testing.T) {
+	src := "SELECT a FROM t WHERE (a = 1 OR b = 2) AND c = 3"
+	cst, err := ParseCST(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	sel := cst.Statements[0].(*SelectStmt)
+	if got := cst.Lookup(sel.Selection).Text(); got != "(a = 1 OR b = 2) AND c = 3" {
+		t.Fatalf("unexpected AND text %q", got)
+	}
+	if got := cst.NodeAt(strings.Index(src, "(")); got != sel.Selection {
+		t.Fatalf("NodeAt on '(' returned %v", got)
+	}
+	out, err := cst.Replace(sel.Selection, "x = 1")
+	if err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if want := "SELECT a FROM t WHERE x = 1"; out != want {
+		t.Fatalf("unexpected edit:\n got %q\nwant %q", out, want)
+	}
+	if _, err := ParseString(out); err != nil {
+		t.Fatalf("edited source does not parse: %v", err)
+	}
+
+	src = "(SELECT a FROM t) UNION SELECT b FROM u"
+	cst, err = ParseCST(src)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if got := cst.Lookup(cst.Statements[0]).Text(); got != src {
+		t.Fatalf("unexpected UNION text %q", got)
+	}
+}
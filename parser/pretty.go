@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/vvshulga/db_internals/lexer"
+)
+
+// prettyWidth is the line length Pretty tries to stay within
+const prettyWidth = 80
+
+// Pretty renders a statement as multi-line SQL in the canonical style of
+// Format: each clause starts a new line, nested queries are indented by two
+// spaces, and lists or conditions that do not fit in 80 columns are broken
+// one item per line. A statement holding a string literal that spans lines
+// is kept on one line so the literal is not re-indented.
+func Pretty(stmt Statement) string {
+	multiline := false
+	Inspect(stmt, func(n Node) bool {
+		if s, ok := n.(*LiteralString); ok && strings.Contains(s.Value, "\n") {
+			multiline = true
+		}
+		return !multiline
+	})
+	if multiline {
+		return Format(stmt)
+	}
+	return prettyStatement(stmt, prettyWidth)
+}
+
+func prettyStatement(n Statement, width int) string {
+	switch x := n.(type) {
+	case *SelectStmt:
+		return prettySelect(x, width)
+	case *InsertStmt:
+		return prettyInsert(x, width)
+	case *UpdateStmt:
+		lines := prettyWith(x.With, width)
+		lines = append(lines, "UPDATE "+x.TableName)
+		set := make([]string, len(x.Set))
+		for i, a := range x.Set {
+			set[i] = sqlAssignment(a)
+		}
+		lines = append(lines, prettyList("SET", set, width))
+		if x.Selection != nil {
+			lines = append(lines, prettyCondition("WHERE", x.Selection, width))
+		}
+		lines = append(lines, prettyReturning(x.Returning, width)...)
+		return strings.Join(lines, "\n")
+	case *DeleteStmt:
+		lines := prettyWith(x.With, width)
+		lines = append(lines, "DELETE FROM "+x.TableName)
+		if x.Selection != nil {
+			lines = append(lines, prettyCondition("WHERE", x.Selection, width))
+		}
+		lines = append(lines, prettyReturning(x.Returning, width)...)
+		return strings.Join(lines, "\n")
+	case *CreateTableStmt:
+		if x.AsSelect != nil {
+			return sqlCreateTableHead(x) + " AS\n" + prettySelect(x.AsSelect, width)
+		}
+		return sqlCreateTableHead(x) + " (\n  " + strings.Join(sqlTableElements(x), ",\n  ") + "\n)"
+	case *AlterTableStmt:
+		actions := make([]string, len(x.Actions))
+		for i, a := range x.Actions {
+			actions[i] = sqlAlterTableAction(a)
+		}
+		return prettyList("ALTER TABLE "+x.TableName, actions, width)
+	case *CreateViewStmt:
+		return sqlViewHead(x) + " AS\n" + prettySelect(x.Query, width)
+	case *PrepareStmt:
+		return sqlPrepareHead(x) + " AS\n" + prettyStatement(x.Statement, width)
+	case *ExplainStmt:
+		return sqlExplainHead(x) + "\n" + prettyStatement(x.Statement, width)
+	}
+	return sqlStatement(n)
+}
+
+func prettySelect(s *SelectStmt, width int) string {
+	lines := prettyWith(s.With, width)
+	if s.SetOp != nil {
+		prec := setOpPrecedence(s)
+		op := s.SetOp.Op
+		if s.SetOp.All {
+			op += " ALL"
+		}
+		lines = append(lines,
+			prettySetOperand(s.SetOp.Left, prec, false, width),
+			op,
+			prettySetOperand(s.SetOp.Right, prec, true, width))
+	} else {
+		items := make([]string, len(s.Projections))
+		for i, p := range s.Projections {
+			items[i] = sqlProjection(p)
+		}
+		lines = append(lines, prettyList("SELECT", items, width))
+		from := "FROM " + sqlTableRef(s.From)
+		if s.From.Subquery != nil {
+			from = "FROM " + prettySubquery(s.From.Subquery, width)
+			if s.From.Alias != "" {
+				from += " AS " + s.From.Alias
+			}
+		}
+		lines = append(lines, from)
+		if s.Selection != nil {
+			lines = append(lines, prettyCondition("WHERE", s.Selection, width))
+		}
+		if len(s.Windows) > 0 {
+			windows := make([]string, len(s.Windows))
+			for i, w := range s.Windows {
+				windows[i] = w.Name + " AS (" + sqlWindowSpec(&w.Spec) + ")"
+			}
+			lines = append(lines, prettyList("WINDOW", windows, width))
+		}
+	}
+	if len(s.OrderBy) > 0 {
+		items := make([]string, len(s.OrderBy))
+		for i, item := range s.OrderBy {
+			items[i] = sqlOrderByItem(item)
+		}
+		lines = append(lines, prettyList("ORDER BY", items, width))
+	}
+	if s.Limit != nil {
+		lines = append(lines, fmt.Sprintf("LIMIT %d", *s.Limit))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func prettySetOperand(s *SelectStmt, parentPrec int, right bool, width int) string {
+	if setOperandNeedsParens(s, parentPrec, right) {
+		return prettySubquery(s, width)
+	}
+	return prettySelect(s, width)
+}
+
+// prettySubquery renders a query between parentheses on lines of its own
+func prettySubquery(s *SelectStmt, width int) string {
+	return "(\n" + indentLines(prettySelect(s, width-2)) + "\n)"
+}
+
+func prettyWith(w *WithClause, width int) []string {
+	if w == nil {
+		return nil
+	}
+	ctes := make([]string, len(w.CTEs))
+	for i, cte := range w.CTEs {
+		ctes[i] = sqlCTEHead(cte) + " AS " + prettySubquery(cte.Query, width)
+	}
+	head := "WITH "
+	if w.Recursive {
+		head = "WITH RECURSIVE "
+	}
+	return []string{head + strings.Join(ctes, ",\n")}
+}
+
+func prettyInsert(ins *InsertStmt, width int) string {
+	lines := prettyWith(ins.With, width)
+	head := "INSERT INTO " + ins.TableName
+	if len(ins.Columns) > 0 {
+		head = prettyParenList(head, ins.Columns, width)
+	}
+	lines = append(lines, head)
+	values := make([]string, len(ins.Values))
+	for i, v := range ins.Values {
+		values[i] = sqlOperand(v)
+	}
+	lines = append(lines, prettyParenList("VALUES", values, width))
+	if ins.OnConflict != nil {
+		lines = append(lines, sqlOnConflict(ins.OnConflict))
+	}
+	lines = append(lines, prettyReturning(ins.Returning, width)...)
+	return strings.Join(lines, "\n")
+}
+
+func prettyReturning(items []ProjectionItem, width int) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	out := make([]string, len(items))
+	for i, p := range items {
+		out[i] = sqlProjection(p)
+	}
+	return []string{prettyList("RETURNING", out, width)}
+}
+
+// prettyList renders head followed by a comma-separated list, moving every
+// item to an indented line of its own when the list does not fit
+func prettyList(head string, items []string, width int) string {
+	line := head + " " + strings.Join(items, ", ")
+	if len(line) <= width || len(items) < 2 {
+		return line
+	}
+	return head + "\n  " + strings.Join(items, ",\n  ")
+}
+
+// prettyParenList is prettyList for a parenthesized list
+func prettyParenList(head string, items []string, width int) string {
+	line := head + " (" + strings.Join(items, ", ") + ")"
+	if len(line) <= width || len(items) < 2 {
+		return line
+	}
+	return head + " (\n  " + strings.Join(items, ",\n  ") + "\n)"
+}
+
+// prettyCondition renders head followed by a condition. A condition that does
+// not fit is broken before each AND or OR of its outermost chain.
+func prettyCondition(head string, e Expr, width int) string {
+	line := head + " " + sqlExpr(e)
+	top, ok := e.(*LogicalOp)
+	if len(line) <= width || !ok {
+		return line
+	}
+	var rights []Expr
+	cur := e
+	for {
+		l, ok := cur.(*LogicalOp)
+		if !ok || l.Op != top.Op {
+			break
+		}
+		rights = append(rights, l.Right)
+		cur = l.Left
+	}
+	lines := []string{head + " " + sqlLogicalOperand(cur, top.Op, false)}
+	for i := len(rights) - 1; i >= 0; i-- {
+		lines = append(lines, "  "+top.Op+" "+sqlLogicalOperand(rights[i], top.Op, true))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func indentLines(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
+
+// scriptBlock is one line group of a formatted script: a comment or a
+// statement with the comments that trail it on the same line
+type scriptBlock struct {
+	text        string
+	blankBefore bool
+}
+
+// FormatScript reformats a SQL script, printing every statement with Pretty
+// and terminating it with a semicolon. Comments are kept: comments between
+// statements stay where they are, a comment on the same line after a
+// statement stays on that line, and comments inside a statement are moved
+// to the lines just before it. A single blank line is kept wherever the
+// script had one or more.
+func FormatScript(src string) (string, error) {
+	stmts, err := ParseString(src)
+	if err != nil {
+		return "", err
+	}
+	tokens, spans := lexer.TokenizeAll(src)
+
+	// statement i covers the source from starts[i] up to ends[i], the end of
+	// its last token including the semicolon
+	starts := make([]int, len(stmts)+1)
+	ends := make([]int, len(stmts))
+	for i, stmt := range stmts {
+		starts[i] = stmt.Pos().Offset
+	}
+	starts[len(stmts)] = len(src)
+	j := 0
+	for i, tok := range tokens {
+		if tok.Type == lexer.TokenWhitespace || tok.Type == lexer.TokenComment || len(stmts) == 0 {
+			continue
+		}
+		for j+1 < len(stmts) && spans[i].Start >= starts[j+1] {
+			j++
+		}
+		ends[j] = spans[i].End
+	}
+
+	leading := make([][]scriptBlock, len(stmts))
+	trailing := make([][]string, len(stmts))
+	moved := make([]bool, len(stmts))
+	var tail []scriptBlock
+	for i, tok := range tokens {
+		if tok.Type != lexer.TokenComment {
+			continue
+		}
+		at := spans[i].Start
+		block := scriptBlock{text: tok.Value, blankBefore: blankLineBefore(src, at)}
+		owner := len(stmts) - 1
+		for owner >= 0 && starts[owner] > at {
+			owner--
+		}
+		switch {
+		case len(stmts) == 0:
+			tail = append(tail, block)
+		case owner < 0:
+			leading[0] = append(leading[0], block)
+		case at < ends[owner]:
+			// inside the statement: keep it, just before the statement. The
+			// first such comment takes over the statement's blank line.
+			block.blankBefore = !moved[owner] && blankLineBefore(src, starts[owner])
+			moved[owner] = true
+			leading[owner] = append(leading[owner], block)
+		case !strings.Contains(src[ends[owner]:at], "\n"):
+			trailing[owner] = append(trailing[owner], tok.Value)
+		case owner+1 < len(stmts):
+			leading[owner+1] = append(leading[owner+1], block)
+		default:
+			tail = append(tail, block)
+		}
+	}
+
+	var blocks []scriptBlock
+	for i, stmt := range stmts {
+		blocks = append(blocks, leading[i]...)
+		text := Pretty(stmt) + ";"
+		if len(trailing[i]) > 0 {
+			text += " " + strings.Join(trailing[i], " ")
+		}
+		blocks = append(blocks, scriptBlock{text: text, blankBefore: !moved[i] && blankLineBefore(src, starts[i])})
+	}
+	blocks = append(blocks, tail...)
+
+	var b strings.Builder
+	for i, block := range blocks {
+		if i > 0 && block.blankBefore {
+			b.WriteString("\n")
+		}
+		b.WriteString(block.text + "\n")
+	}
+	return b.String(), nil
+}
+
+// blankLineBefore reports whether the whitespace before offset at spans an
+// empty line
+func blankLineBefore(src string, at int) bool {
+	newlines := 0
+	for i := at - 1; i >= 0 && strings.ContainsRune(" \t\r\n", rune(src[i])); i-- {
+		if src[i] == '\n' {
+			newlines++
+		}
+	}
+	return newlines >= 2
+}
@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/vvshulga/db_internals/lexer"
+)
+
+// DataType is a column or cast type such as INT, VARCHAR(255), DECIMAL(10,2) or TEXT[]
+type DataType struct {
+	Name      string // canonical upper-case name, e.g. VARCHAR
+	Length    uint64 // VARCHAR(n), CHAR(n); 0 when not given
+	Precision uint64 // DECIMAL(p,s), FLOAT(p); 0 when not given
+	Scale     uint64 // DECIMAL(p,s); 0 when not given
+	HasScale  bool   // whether a scale was given, which may be 0
+	ArrayDims int    // number of [] suffixes
+}
+
+// String returns the type as it would be written in SQL
+func (t DataType) String() string {
+	out := t.Name
+	switch {
+	case t.Length > 0:
+		out += fmt.Sprintf("(%d)", t.Length)
+	case t.Precision > 0 && t.HasScale:
+		out += fmt.Sprintf("(%d,%d)", t.Precision, t.Scale)
+	case t.Precision > 0:
+		out += fmt.Sprintf("(%d)", t.Precision)
+	}
+	return out + strings.Repeat("[]", t.ArrayDims)
+}
+
+// typeParams describes which parenthesized parameters a type accepts
+type typeParams int
+
+const (
+	noParams typeParams = iota
+	lengthParam
+	precisionParam
+	precisionScaleParams
+)
+
+type typeInfo struct {
+	name   string // canonical name
+	params typeParams
+}
+
+// dataTypes maps every accepted type name (including aliases) to its canonical form
+var dataTypes = map[string]typeInfo{
+	"INT":       {"INT", noParams},
+	"INTEGER":   {"INT", noParams},
+	"BIGINT":    {"BIGINT", noParams},
+	"SMALLINT":  {"SMALLINT", noParams},
+	"FLOAT":     {"FLOAT", precisionParam},
+	"REAL":      {"FLOAT", noParams},
+	"DOUBLE":    {"DOUBLE", noParams},
+	"DECIMAL":   {"DECIMAL", precisionScaleParams},
+	"NUMERIC":   {"DECIMAL", precisionScaleParams},
+	"VARCHAR":   {"VARCHAR", lengthParam},
+	"CHAR":      {"CHAR", lengthParam},
+	"CHARACTER": {"CHAR", lengthParam},
+	"TEXT":      {"TEXT", noParams},
+	"BOOLEAN":   {"BOOLEAN", noParams},
+	"BOOL":      {"BOOLEAN", noParams},
+	"DATE":      {"DATE", noParams},
+	"TIME":      {"TIME", noParams},
+	"TIMESTAMP": {"TIMESTAMP", noParams},
+	"BLOB":      {"BLOB", noParams},
+	"BYTEA":     {"BYTEA", noParams},
+}
+
+// parseDataType parses <type_name> [( n [, n] )] { [ [n] ] } and rejects unknown types
+func (p *parser) parseDataType() (DataType, error) {
+	if p.peek() == nil || p.peek().Type != lexer.TokenIdentifier {
+		return DataType{}, fmt.Errorf("expected type name, got %v", p.peek())
+	}
+	raw := p.next().Value
+	info, ok := dataTypes[strings.ToUpper(raw)]
+	if !ok {
+		return DataType{}, fmt.Errorf("unknown type %s", raw)
+	}
+	typ := DataType{Name: info.name}
+	// DOUBLE PRECISION is the standard spelling of DOUBLE
+	if info.name == "DOUBLE" {
+		p.consumeWord("PRECISION")
+	}
+	if p.peekSeparator("(") {
+		if info.params == noParams {
+			return DataType{}, fmt.Errorf("type %s does not take parameters", info.name)
+		}
+		p.next()
+		first, err := p.parseTypeParam(info.name)
+		if err != nil {
+			return DataType{}, err
+		}
+		// length and precision must be positive; only the scale may be 0
+		if first == 0 {
+			return DataType{}, fmt.Errorf("parameter of type %s must be positive", info.name)
+		}
+		switch info.params {
+		case lengthParam:
+			typ.Length = first
+		default:
+			typ.Precision = first
+		}
+		if info.params == precisionScaleParams && p.peekSeparator(",") {
+			p.next()
+			scale, err := p.parseTypeParam(info.name)
+			if err != nil {
+				return DataType{}, err
+			}
+			if scale > typ.Precision {
+				return DataType{}, fmt.Errorf("scale %d exceeds precision %d for type %s", scale, typ.Precision, info.name)
+			}
+			typ.Scale = scale
+			typ.HasScale = true
+		}
+		if !p.peekSeparator(")") {
+			return DataType{}, fmt.Errorf("expected ')' after parameters of type %s, got %v", info.name, p.peek())
+		}
+		p.next()
+	}
+	// array dimensions; declared sizes are accepted but not recorded
+	for p.peekSeparator("[") {
+		p.next()
+		if p.peek() != nil && p.peek().Type == lexer.TokenNumber {
+			p.next()
+		}
+		if !p.peekSeparator("]") {
+			return DataType{}, fmt.Errorf("expected ']' in array type, got %v", p.peek())
+		}
+		p.next()
+		typ.ArrayDims++
+	}
+	return typ, nil
+}
+
+// parseTypeParam parses a non-negative integer type parameter
+func (p *parser) parseTypeParam(typeName string) (uint64, error) {
+	if p.peek() == nil || p.peek().Type != lexer.TokenNumber {
+		return 0, fmt.Errorf("expected number in parameters of type %s, got %v", typeName, p.peek())
+	}
+	v := p.next().Value
+	u, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid parameter %s for type %s", v, typeName)
+	}
+	return u, nil
+}
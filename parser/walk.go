@@ -0,0 +1,253 @@
+package parser
+
+import "fmt"
+
+// Visitor receives the nodes of an AST during Walk. Enter is called before
+// a node's children are visited; returning false skips the children and the
+// matching Leave. Leave is called after all children have been visited.
+type Visitor interface {
+	Enter(n Node) bool
+	Leave(n Node)
+}
+
+// Walk traverses the AST rooted at n depth-first, in source order,
+// calling v.Enter and v.Leave for every statement and expression node.
+// Nodes held by clauses such as ProjectionItem or ColumnDef are visited as
+// children of the statement that owns the clause.
+func Walk(n Node, v Visitor) {
+	if !v.Enter(n) {
+		return
+	}
+	rewriteChildren(n, func(child Node) Node {
+		Walk(child, v)
+		return child
+	})
+	v.Leave(n)
+}
+
+// inspector adapts a function to the Visitor interface
+type inspector func(Node) bool
+
+func (f inspector) Enter(n Node) bool { return f(n) }
+func (f inspector) Leave(Node)        {}
+
+// Inspect traverses the AST rooted at n like Walk, calling f before each
+// node's children. If f returns false the children are skipped.
+func Inspect(n Node, f func(Node) bool) {
+	Walk(n, inspector(f))
+}
+
+// Rewrite traverses the AST rooted at n bottom-up, replacing every node with
+// f(node) after its children have been rewritten, and returns the new root.
+// f may return its argument unchanged. A replacement must fit the slot it
+// fills: an Expr for an expression, a Statement for a statement and a
+// *SelectStmt where a query is required; Rewrite panics otherwise.
+func Rewrite(n Node, f func(Node) Node) Node {
+	rewriteChildren(n, func(child Node) Node {
+		return Rewrite(child, f)
+	})
+	return f(n)
+}
+
+// rewriteChildren replaces every direct child node of n with f(child), in
+// source order. Slots are only written when f returns a different node, so
+// read-only traversals never modify the tree.
+func rewriteChildren(n Node, f func(Node) Node) {
+	switch x := n.(type) {
+	case *SelectStmt:
+		rewriteWith(x.With, f)
+		if x.SetOp != nil {
+			rewriteSelect(&x.SetOp.Left, f)
+			rewriteSelect(&x.SetOp.Right, f)
+		}
+		rewriteProjections(x.Projections, f)
+		rewriteSelect(&x.From.Subquery, f)
+		rewriteExpr(&x.Selection, f)
+		for i := range x.Windows {
+			rewriteWindowSpec(&x.Windows[i].Spec, f)
+		}
+		rewriteOrderBy(x.OrderBy, f)
+	case *InsertStmt:
+		rewriteWith(x.With, f)
+		rewriteExprs(x.Values, f)
+		if x.OnConflict != nil {
+			rewriteAssignments(x.OnConflict.Set, f)
+			rewriteExpr(&x.OnConflict.Where, f)
+		}
+		rewriteProjections(x.Returning, f)
+	case *UpdateStmt:
+		rewriteWith(x.With, f)
+		rewriteAssignments(x.Set, f)
+		rewriteExpr(&x.Selection, f)
+		rewriteProjections(x.Returning, f)
+	case *DeleteStmt:
+		rewriteWith(x.With, f)
+		rewriteExpr(&x.Selection, f)
+		rewriteProjections(x.Returning, f)
+	case *CreateTableStmt:
+		for i := range x.Columns {
+			rewriteColumnDef(&x.Columns[i], f)
+		}
+		for i := range x.Constraints {
+			rewriteExpr(&x.Constraints[i].Check, f)
+		}
+		rewriteSelect(&x.AsSelect, f)
+	case *AlterTableStmt:
+		for i := range x.Actions {
+			a := &x.Actions[i]
+			if a.Column != nil {
+				rewriteColumnDef(a.Column, f)
+			}
+			rewriteExpr(&a.Default, f)
+			if a.Constraint != nil {
+				rewriteExpr(&a.Constraint.Check, f)
+			}
+		}
+	case *CreateIndexStmt:
+		rewriteExpr(&x.Where, f)
+	case *CreateViewStmt:
+		rewriteSelect(&x.Query, f)
+	case *PrepareStmt:
+		rewriteStatement(&x.Statement, f)
+	case *ExecuteStmt:
+		rewriteExprs(x.Args, f)
+	case *ExplainStmt:
+		rewriteStatement(&x.Statement, f)
+	case *DropIndexStmt, *RefreshMaterializedViewStmt, *BeginStmt, *CommitStmt,
+		*RollbackStmt, *SavepointStmt, *ReleaseSavepointStmt, *DeallocateStmt:
+		// no children
+
+	case *BinaryOp:
+		rewriteExpr(&x.Left, f)
+		rewriteExpr(&x.Right, f)
+	case *LogicalOp:
+		rewriteExpr(&x.Left, f)
+		rewriteExpr(&x.Right, f)
+	case *ComparisonOp:
+		rewriteExpr(&x.Left, f)
+		rewriteExpr(&x.Right, f)
+	case *SubqueryExpr:
+		rewriteSelect(&x.Select, f)
+	case *ExistsExpr:
+		rewriteSelect(&x.Subquery, f)
+	case *InExpr:
+		rewriteExpr(&x.Left, f)
+		rewriteSelect(&x.Subquery, f)
+		rewriteExprs(x.List, f)
+	case *BetweenExpr:
+		rewriteExpr(&x.Expr, f)
+		rewriteExpr(&x.Low, f)
+		rewriteExpr(&x.High, f)
+	case *LikeExpr:
+		rewriteExpr(&x.Left, f)
+		rewriteExpr(&x.Pattern, f)
+		rewriteExpr(&x.Escape, f)
+	case *CaseExpr:
+		rewriteExpr(&x.Operand, f)
+		for i := range x.Whens {
+			rewriteExpr(&x.Whens[i].Cond, f)
+			rewriteExpr(&x.Whens[i].Result, f)
+		}
+		rewriteExpr(&x.Else, f)
+	case *FuncCall:
+		rewriteExprs(x.Args, f)
+		if x.Over != nil {
+			rewriteWindowSpec(x.Over, f)
+		}
+	case *CastExpr:
+		rewriteExpr(&x.Expr, f)
+	case *ColumnRef, *LiteralInt, *LiteralString, *LiteralNull, *Param:
+		// leaves
+
+	default:
+		panic(fmt.Sprintf("parser: unexpected node type %T", n))
+	}
+}
+
+func rewriteExpr(slot *Expr, f func(Node) Node) {
+	if *slot == nil {
+		return
+	}
+	if r := f(*slot); r != Node(*slot) {
+		e, ok := r.(Expr)
+		if !ok {
+			panic(fmt.Sprintf("parser: cannot replace expression with %T", r))
+		}
+		*slot = e
+	}
+}
+
+func rewriteExprs(list []Expr, f func(Node) Node) {
+	for i := range list {
+		rewriteExpr(&list[i], f)
+	}
+}
+
+func rewriteSelect(slot **SelectStmt, f func(Node) Node) {
+	if *slot == nil {
+		return
+	}
+	if r := f(*slot); r != Node(*slot) {
+		sel, ok := r.(*SelectStmt)
+		if !ok {
+			panic(fmt.Sprintf("parser: cannot replace query with %T", r))
+		}
+		*slot = sel
+	}
+}
+
+func rewriteStatement(slot *Statement, f func(Node) Node) {
+	if *slot == nil {
+		return
+	}
+	if r := f(*slot); r != Node(*slot) {
+		stmt, ok := r.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("parser: cannot replace statement with %T", r))
+		}
+		*slot = stmt
+	}
+}
+
+func rewriteWith(w *WithClause, f func(Node) Node) {
+	if w == nil {
+		return
+	}
+	for i := range w.CTEs {
+		rewriteSelect(&w.CTEs[i].Query, f)
+	}
+}
+
+func rewriteProjections(items []ProjectionItem, f func(Node) Node) {
+	for i := range items {
+		rewriteExpr(&items[i].Expr, f)
+	}
+}
+
+func rewriteOrderBy(items []OrderByItem, f func(Node) Node) {
+	for i := range items {
+		rewriteExpr(&items[i].Expr, f)
+	}
+}
+
+func rewriteAssignments(set []Assignment, f func(Node) Node) {
+	for i := range set {
+		rewriteExpr(&set[i].Value, f)
+	}
+}
+
+func rewriteWindowSpec(w *WindowSpec, f func(Node) Node) {
+	rewriteExprs(w.PartitionBy, f)
+	rewriteOrderBy(w.OrderBy, f)
+	if w.Frame != nil {
+		rewriteExpr(&w.Frame.Start.Offset, f)
+		if w.Frame.End != nil {
+			rewriteExpr(&w.Frame.End.Offset, f)
+		}
+	}
+}
+
+func rewriteColumnDef(c *ColumnDef, f func(Node) Node) {
+	rewriteExpr(&c.Default, f)
+	rewriteExpr(&c.Check, f)
+}